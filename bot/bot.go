@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/bwmarrin/discordgo"
@@ -15,6 +16,8 @@ import (
 // Messager is an interface that abstracts the discordgo.Session for testing.
 type Messager interface {
 	ChannelMessageSend(channelID, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
 	ChannelVoiceJoin(guildID, channelID string, mute, deaf bool) (voice *discordgo.VoiceConnection, err error)
 	ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string, options ...discordgo.RequestOption) ([]*discordgo.Message, error)
 	ChannelMessagesBulkDelete(channelID string, messages []string, options ...discordgo.RequestOption) error
@@ -24,6 +27,10 @@ type Messager interface {
 // Command is the interface for all bot commands.
 type Command interface {
 	Name() string
+	Description() string // one line shown in help and as the slash command description
+	Usage() string       // arguments after the command name, e.g. "<entity> [duration]"
+	Examples() []string  // example invocations without the prefix
+	Capability() Capability
 	Execute(s Messager, m *discordgo.MessageCreate, args []string)
 }
 
@@ -32,6 +39,9 @@ type Bot struct {
 	Session  *discordgo.Session
 	Config   *config.Config
 	Commands map[string]Command
+
+	components      map[string]component
+	componentsMutex sync.Mutex
 }
 
 // New creates a new Bot instance.
@@ -44,11 +54,14 @@ func New(cfg *config.Config) (*Bot, error) {
 	// Set the necessary intents.
 	s.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages
 
-	return &Bot{
-		Session:  s,
-		Config:   cfg,
-		Commands: make(map[string]Command),
-	}, nil
+	b := &Bot{
+		Session:    s,
+		Config:     cfg,
+		Commands:   make(map[string]Command),
+		components: make(map[string]component),
+	}
+	b.RegisterCommand(&help{bot: b})
+	return b, nil
 }
 
 // RegisterCommand registers a new command.
@@ -60,6 +73,7 @@ func (b *Bot) RegisterCommand(cmd Command) {
 func (b *Bot) Start() {
 	b.Session.AddHandler(b.ready)
 	b.Session.AddHandler(b.messageCreate)
+	b.Session.AddHandler(b.HandleInteraction)
 
 	err := b.Session.Open()
 	if err != nil {
@@ -82,6 +96,8 @@ func (b *Bot) ready(s *discordgo.Session, event *discordgo.Ready) {
 	for _, guild := range s.State.Guilds {
 		fmt.Printf("- %s\n", guild.Name)
 	}
+
+	b.registerSlashCommands(s)
 }
 
 // messageCreate is the handler for new messages.
@@ -90,11 +106,12 @@ func (b *Bot) messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
-	if !strings.HasPrefix(m.Content, b.Config.Prefix) {
+	prefix := b.Config.CommandPrefix()
+	if !strings.HasPrefix(m.Content, prefix) {
 		return
 	}
 
-	content := strings.TrimPrefix(m.Content, b.Config.Prefix)
+	content := strings.TrimPrefix(m.Content, prefix)
 	parts := strings.Fields(content)
 	if len(parts) == 0 {
 		return
@@ -108,5 +125,10 @@ func (b *Bot) messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
+	if !b.Allowed(m.Author, m.Member, cmd.Capability()) {
+		s.ChannelMessageSend(m.ChannelID, b.denied(m.Author, cmdName, cmd.Capability()))
+		return
+	}
+
 	cmd.Execute(s, m, args)
 }
\ No newline at end of file
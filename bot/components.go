@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ComponentHandler handles a button press. Args are the custom ID parts after
+// the handler name. The press is acknowledged before the handler runs, so it
+// may be slow. The returned status line is appended to the message, whose
+// buttons are then removed.
+type ComponentHandler func(user *discordgo.User, args []string) string
+
+// ComponentUpdater handles a button press by replacing the content,
+// embeds and components of the message the button is attached to.
+type ComponentUpdater func(user *discordgo.User, args []string) *discordgo.MessageSend
+
+// componentIDSeparator separates the parts of a component custom ID.
+const componentIDSeparator = ":"
+
+// MaxCustomID is the longest custom ID Discord accepts for a component.
+const MaxCustomID = 100
+
+// ComponentID builds a custom ID routed to the handler registered under name.
+func ComponentID(name string, args ...string) string {
+	return strings.Join(append([]string{name}, args...), componentIDSeparator)
+}
+
+// component is a registered component handler or updater and the capability
+// needed to use it.
+type component struct {
+	capability Capability
+	handler    ComponentHandler
+	updater    ComponentUpdater
+}
+
+// RegisterComponentHandler registers a handler for message components whose
+// custom ID was built with ComponentID(name, ...). Users without the
+// capability are refused.
+func (b *Bot) RegisterComponentHandler(name string, capability Capability, handler ComponentHandler) {
+	b.componentsMutex.Lock()
+	defer b.componentsMutex.Unlock()
+	b.components[name] = component{capability: capability, handler: handler}
+}
+
+// RegisterComponentUpdater registers an updater for message components whose
+// custom ID was built with ComponentID(name, ...), e.g. pagination buttons.
+// Users without the capability are refused.
+func (b *Bot) RegisterComponentUpdater(name string, capability Capability, updater ComponentUpdater) {
+	b.componentsMutex.Lock()
+	defer b.componentsMutex.Unlock()
+	b.components[name] = component{capability: capability, updater: updater}
+}
+
+// handleComponent routes a button press to its registered handler.
+func (b *Bot) handleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	parts := strings.Split(i.MessageComponentData().CustomID, componentIDSeparator)
+
+	b.componentsMutex.Lock()
+	c, ok := b.components[parts[0]]
+	b.componentsMutex.Unlock()
+	if !ok {
+		log.Printf("No handler for component %s", i.MessageComponentData().CustomID)
+		return
+	}
+
+	user := interactionUser(i.Interaction)
+	if !b.Allowed(user, i.Member, c.capability) {
+		log.Printf("Denied component %s to %s: requires %s", i.MessageComponentData().CustomID, user.Username, c.capability)
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("🚫 **Permission denied:** this button requires the `%s` permission.", c.capability),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Printf("Error responding to denied component %s: %v", i.MessageComponentData().CustomID, err)
+		}
+		return
+	}
+
+	if c.updater != nil {
+		update := c.updater(user, parts[1:])
+		data := &discordgo.InteractionResponseData{
+			Content:    update.Content,
+			Embeds:     update.Embeds,
+			Components: update.Components,
+		}
+		if data.Embeds == nil {
+			data.Embeds = []*discordgo.MessageEmbed{}
+		}
+		if data.Components == nil {
+			data.Components = []discordgo.MessageComponent{}
+		}
+
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: data,
+		})
+		if err != nil {
+			log.Printf("Error responding to component %s: %v", i.MessageComponentData().CustomID, err)
+		}
+		return
+	}
+
+	// Handlers may call Home Assistant, so acknowledge the press before running
+	// them to stay within Discord's 3 second limit, then edit the message.
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.Printf("Error deferring response to component %s: %v", i.MessageComponentData().CustomID, err)
+		return
+	}
+
+	status := c.handler(user, parts[1:])
+
+	content := status
+	if i.Message != nil {
+		content = i.Message.Content + "\n" + status
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:    &content,
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		log.Printf("Error responding to component %s: %v", i.MessageComponentData().CustomID, err)
+	}
+}
@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// helpColor is the accent color of help embeds.
+const helpColor = 0x41bdf5
+
+// help is the built-in help command, generated from the command registry.
+type help struct {
+	bot *Bot
+}
+
+// Name returns the command's name.
+func (h *help) Name() string {
+	return "help"
+}
+
+// Capability returns the permission needed to run the command.
+func (h *help) Capability() Capability {
+	return CapabilityView
+}
+
+// Description returns the slash command description.
+func (h *help) Description() string {
+	return "List the commands you can run, or show how to use one"
+}
+
+// Usage returns the command's arguments for help.
+func (h *help) Usage() string {
+	return "[command]"
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (h *help) Examples() []string {
+	return []string{"help", "help pause"}
+}
+
+// Options returns the slash command options.
+func (h *help) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "command",
+		Description:  "Command to show details for",
+		Autocomplete: true,
+	}}
+}
+
+// autocompleteFor suggests the names of the commands the user may run.
+func (h *help) autocompleteFor(user *discordgo.User, member *discordgo.Member, option, value string) []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, name := range h.names() {
+		if !h.bot.Allowed(user, member, h.bot.Commands[name].Capability()) {
+			continue
+		}
+		if strings.HasPrefix(name, strings.ToLower(value)) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+		}
+	}
+	return choices
+}
+
+// Execute runs the command.
+func (h *help) Execute(s Messager, m *discordgo.MessageCreate, args []string) {
+	var embed *discordgo.MessageEmbed
+	if len(args) == 0 {
+		embed = h.list(m)
+	} else {
+		name := strings.TrimPrefix(strings.ToLower(args[0]), h.bot.Config.CommandPrefix())
+		cmd, ok := h.bot.Commands[name]
+		if !ok || !h.bot.Allowed(m.Author, m.Member, cmd.Capability()) {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Unknown command `%s`**\n\nUse `%shelp` to list the commands you can run.", args[0], h.bot.Config.CommandPrefix()))
+			return
+		}
+		embed = h.details(cmd)
+	}
+
+	s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}})
+}
+
+// list builds an embed listing every command the author may run.
+func (h *help) list(m *discordgo.MessageCreate) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:  "📖 Commands",
+		Color:  helpColor,
+		Footer: &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Use %shelp <command> for details and examples.", h.bot.Config.CommandPrefix())},
+	}
+	for _, name := range h.names() {
+		cmd := h.bot.Commands[name]
+		if !h.bot.Allowed(m.Author, m.Member, cmd.Capability()) {
+			continue
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  h.syntax(cmd),
+			Value: cmd.Description(),
+		})
+	}
+	return embed
+}
+
+// details builds an embed describing a single command.
+func (h *help) details(cmd Command) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("📖 %s%s", h.bot.Config.CommandPrefix(), cmd.Name()),
+		Description: cmd.Description(),
+		Color:       helpColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Usage", Value: fmt.Sprintf("`%s`", h.syntax(cmd))},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Requires the %s permission. Also available as /%s.", cmd.Capability(), cmd.Name())},
+	}
+
+	if examples := cmd.Examples(); len(examples) > 0 {
+		var sb strings.Builder
+		for _, example := range examples {
+			sb.WriteString(fmt.Sprintf("`%s%s`\n", h.bot.Config.CommandPrefix(), example))
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Examples", Value: sb.String()})
+	}
+	return embed
+}
+
+// syntax returns the command name with the prefix and its usage.
+func (h *help) syntax(cmd Command) string {
+	syntax := h.bot.Config.CommandPrefix() + cmd.Name()
+	if usage := cmd.Usage(); usage != "" {
+		syntax += " " + usage
+	}
+	return syntax
+}
+
+// names returns the registered command names in order.
+func (h *help) names() []string {
+	names := make([]string, 0, len(h.bot.Commands))
+	for name := range h.bot.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
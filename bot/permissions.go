@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Capability is a permission a command requires, granted to Discord roles
+// and users in the permissions section of the config.
+type Capability string
+
+// Capabilities known to the bot. They match config.Capabilities.
+const (
+	CapabilityView    Capability = "view"    // read-only commands
+	CapabilityPause   Capability = "pause"   // silencing alerts
+	CapabilityControl Capability = "control" // changing things in Home Assistant
+	CapabilityAdmin   Capability = "admin"   // managing the bot, implies every other capability
+)
+
+// Allowed reports whether the user may use the capability. Without a
+// permissions section in the config every capability is open to everyone.
+// Once there is one, a capability without a grant is limited to admins; the
+// admin grant covers every capability. The member is nil outside of guilds.
+func (b *Bot) Allowed(user *discordgo.User, member *discordgo.Member, capability Capability) bool {
+	permissions := b.Config.Grants()
+	if len(permissions) == 0 {
+		return true
+	}
+
+	grant, ok := permissions[string(capability)]
+	if ok && (grant.Everyone || granted(grant.Users, grant.Roles, user, member)) {
+		return true
+	}
+
+	admin, ok := permissions[string(CapabilityAdmin)]
+	return ok && (admin.Everyone || granted(admin.Users, admin.Roles, user, member))
+}
+
+// granted reports whether the user or one of the member's roles is listed.
+func granted(users, roles []string, user *discordgo.User, member *discordgo.Member) bool {
+	if user != nil && contains(users, user.ID) {
+		return true
+	}
+	if member != nil {
+		for _, role := range member.Roles {
+			if contains(roles, role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// denied logs a refused command and returns the message telling the user why.
+func (b *Bot) denied(user *discordgo.User, name string, capability Capability) string {
+	who := "unknown user"
+	if user != nil {
+		who = fmt.Sprintf("%s (%s)", user.Username, user.ID)
+	}
+	log.Printf("Denied %s%s to %s: requires %s", b.Config.CommandPrefix(), name, who, capability)
+	return fmt.Sprintf("🚫 **Permission denied:** `%s%s` requires the `%s` permission.", b.Config.CommandPrefix(), name, capability)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
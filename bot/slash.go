@@ -0,0 +1,251 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// SlashCommand is implemented by commands that declare typed Discord
+// application (slash) command options. Commands that don't implement it are
+// still registered, with a single free-form "args" option.
+type SlashCommand interface {
+	Command
+	Options() []*discordgo.ApplicationCommandOption
+}
+
+// Autocompleter is implemented by slash commands with autocompleted options.
+type Autocompleter interface {
+	Autocomplete(option, value string) []*discordgo.ApplicationCommandOptionChoice
+}
+
+// userAutocompleter is implemented by commands whose suggestions depend on
+// who asks.
+type userAutocompleter interface {
+	autocompleteFor(user *discordgo.User, member *discordgo.Member, option, value string) []*discordgo.ApplicationCommandOptionChoice
+}
+
+// maxAutocompleteChoices is the number of choices Discord accepts in one response.
+const maxAutocompleteChoices = 25
+
+// applicationCommands builds the application command definitions from the registry.
+func (b *Bot) applicationCommands() []*discordgo.ApplicationCommand {
+	names := make([]string, 0, len(b.Commands))
+	for name := range b.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	appCmds := make([]*discordgo.ApplicationCommand, 0, len(names))
+	for _, name := range names {
+		cmd := b.Commands[name]
+		appCmd := &discordgo.ApplicationCommand{
+			Name:        name,
+			Description: cmd.Description(),
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "args",
+				Description: "Command arguments",
+			}},
+		}
+		if slash, ok := cmd.(SlashCommand); ok {
+			appCmd.Options = slash.Options()
+		}
+		appCmds = append(appCmds, appCmd)
+	}
+	return appCmds
+}
+
+// registerSlashCommands registers the application commands in every guild the bot is in.
+func (b *Bot) registerSlashCommands(s *discordgo.Session) {
+	appCmds := b.applicationCommands()
+	for _, guild := range s.State.Guilds {
+		_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, guild.ID, appCmds)
+		if err != nil {
+			log.Printf("Error registering slash commands in guild %s: %v", guild.ID, err)
+			continue
+		}
+		log.Printf("Registered %d slash commands in guild %s", len(appCmds), guild.ID)
+	}
+}
+
+// HandleInteraction is the handler for slash command, autocomplete and
+// component interactions. Start registers it with the session.
+func (b *Bot) HandleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		b.handleSlashCommand(s, i)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		b.handleAutocomplete(s, i)
+	case discordgo.InteractionMessageComponent:
+		b.handleComponent(s, i)
+	}
+}
+
+// handleSlashCommand runs a command through the same Execute path as prefix commands.
+func (b *Bot) handleSlashCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	cmd, ok := b.Commands[data.Name]
+	if !ok {
+		return
+	}
+
+	user := interactionUser(i.Interaction)
+	if !b.Allowed(user, i.Member, cmd.Capability()) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: b.denied(user, data.Name, cmd.Capability()),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Printf("Error responding to denied /%s: %v", data.Name, err)
+		}
+		return
+	}
+
+	// Defer the response so slow commands don't hit Discord's 3 second limit.
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Printf("Error deferring interaction response for /%s: %v", data.Name, err)
+		return
+	}
+
+	// The content is what the equivalent chat command would be.
+	args := optionArgs(cmd, data.Options)
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        i.ID,
+			ChannelID: i.ChannelID,
+			GuildID:   i.GuildID,
+			Member:    i.Member,
+			Author:    user,
+			Content:   strings.Join(append([]string{b.Config.CommandPrefix() + data.Name}, args...), " "),
+		},
+	}
+
+	responder := &interactionMessager{Session: s, interaction: i.Interaction}
+	cmd.Execute(responder, m, args)
+
+	if !responder.responded {
+		responder.ChannelMessageSend(i.ChannelID, "✅ Done.")
+	}
+}
+
+// handleAutocomplete answers autocomplete requests for the focused option.
+func (b *Bot) handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	cmd, ok := b.Commands[data.Name]
+	if !ok {
+		return
+	}
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, opt := range data.Options {
+		if !opt.Focused {
+			continue
+		}
+		switch completer := cmd.(type) {
+		case userAutocompleter:
+			choices = completer.autocompleteFor(interactionUser(i.Interaction), i.Member, opt.Name, fmt.Sprint(opt.Value))
+		case Autocompleter:
+			choices = completer.Autocomplete(opt.Name, fmt.Sprint(opt.Value))
+		}
+		break
+	}
+	if len(choices) > maxAutocompleteChoices {
+		choices = choices[:maxAutocompleteChoices]
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		log.Printf("Error responding to autocomplete for /%s: %v", data.Name, err)
+	}
+}
+
+// optionArgs flattens slash command options into prefix-style arguments, in
+// the order the command declares them.
+func optionArgs(cmd Command, options []*discordgo.ApplicationCommandInteractionDataOption) []string {
+	values := make(map[string]string, len(options))
+	for _, opt := range options {
+		values[opt.Name] = fmt.Sprint(opt.Value)
+	}
+
+	order := []string{"args"}
+	if slash, ok := cmd.(SlashCommand); ok {
+		order = order[:0]
+		for _, opt := range slash.Options() {
+			order = append(order, opt.Name)
+		}
+	}
+
+	var args []string
+	for _, name := range order {
+		if value, ok := values[name]; ok {
+			args = append(args, strings.Fields(value)...)
+		}
+	}
+	return args
+}
+
+// interactionUser returns the user who triggered an interaction.
+func interactionUser(i *discordgo.Interaction) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// interactionMessager answers an interaction through the Messager interface.
+// The first message edits the deferred response, later ones are follow-ups.
+type interactionMessager struct {
+	*discordgo.Session
+	interaction *discordgo.Interaction
+	responded   bool
+}
+
+// ChannelMessageSend sends content as an interaction response.
+func (r *interactionMessager) ChannelMessageSend(channelID, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if channelID != r.interaction.ChannelID {
+		return r.Session.ChannelMessageSend(channelID, content, options...)
+	}
+
+	if !r.responded {
+		r.responded = true
+		return r.Session.InteractionResponseEdit(r.interaction, &discordgo.WebhookEdit{Content: &content}, options...)
+	}
+	return r.Session.FollowupMessageCreate(r.interaction, true, &discordgo.WebhookParams{Content: content}, options...)
+}
+
+// ChannelMessageSendComplex sends a message with embeds or components as an
+// interaction response.
+func (r *interactionMessager) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if channelID != r.interaction.ChannelID {
+		return r.Session.ChannelMessageSendComplex(channelID, data, options...)
+	}
+
+	if !r.responded {
+		r.responded = true
+		return r.Session.InteractionResponseEdit(r.interaction, &discordgo.WebhookEdit{
+			Content:    &data.Content,
+			Embeds:     &data.Embeds,
+			Components: &data.Components,
+			Files:      data.Files,
+		}, options...)
+	}
+	return r.Session.FollowupMessageCreate(r.interaction, true, &discordgo.WebhookParams{
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Components: data.Components,
+		Files:      data.Files,
+	}, options...)
+}
@@ -0,0 +1,401 @@
+package charts
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Layout of a chart, in pixels.
+const (
+	width        = 800
+	margin       = 12
+	plotHeight   = 280
+	legendHeight = 20
+	rowHeight    = 32
+	axisHeight   = 20
+	minLabelArea = 56
+	maxLabelArea = 200
+	charWidth    = 7 // of basicfont.Face7x13
+	maxTicks     = 8
+)
+
+var (
+	background = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	gridColor  = color.RGBA{0xe4, 0xe4, 0xe7, 0xff}
+	textColor  = color.RGBA{0x27, 0x27, 0x2a, 0xff}
+	mutedColor = color.RGBA{0x71, 0x71, 0x7a, 0xff}
+	offColor   = color.RGBA{0xd1, 0xfa, 0xe5, 0xff}
+	onColor    = color.RGBA{0xdc, 0x26, 0x26, 0xff}
+	noneColor  = color.RGBA{0xa1, 0xa1, 0xaa, 0xff}
+
+	// palette colors the series of a chart in order.
+	palette = []color.RGBA{
+		{0x25, 0x63, 0xeb, 0xff},
+		{0xea, 0x58, 0x0c, 0xff},
+		{0x16, 0xa3, 0x4a, 0xff},
+		{0x93, 0x33, 0xea, 0xff},
+		{0xdb, 0x27, 0x77, 0xff},
+		{0x08, 0x91, 0xb2, 0xff},
+	}
+)
+
+// Point is one value of a series. A NaN value marks a gap, e.g. while the
+// sensor was unavailable.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series is a numeric sensor drawn as a line. Each value holds until the next
+// point, and the last one until the end of the chart.
+type Series struct {
+	Name   string
+	Unit   string
+	Points []Point
+}
+
+// Span is a period a binary sensor spent in one state.
+type Span struct {
+	Start, End  time.Time
+	On          bool
+	Unavailable bool
+}
+
+// Timeline is a binary sensor drawn as a bar, with on periods highlighted.
+type Timeline struct {
+	Name  string
+	Spans []Span
+}
+
+// OnFor returns how long the timeline was on in total.
+func (t Timeline) OnFor() time.Duration {
+	var total time.Duration
+	for _, span := range t.Spans {
+		if span.On {
+			total += span.End.Sub(span.Start)
+		}
+	}
+	return total
+}
+
+// Chart is a history chart of numeric series above binary timelines, sharing
+// a time axis.
+type Chart struct {
+	Start, End time.Time
+	Location   *time.Location // for time labels; local time if nil
+	Series     []Series
+	Timelines  []Timeline
+}
+
+// layout holds the positions computed for rendering a chart.
+type layout struct {
+	left, right  int // of the plot and bars
+	plotTop      int
+	plotBottom   int
+	timelinesTop int
+	axisTop      int
+	height       int
+	minY, maxY   float64
+	yStep        float64
+	seconds      float64
+	start        time.Time
+	location     *time.Location
+}
+
+// EncodePNG renders the chart and writes it as a PNG image.
+func (c *Chart) EncodePNG(w io.Writer) error {
+	return png.Encode(w, c.Render())
+}
+
+// Render draws the chart.
+func (c *Chart) Render() *image.RGBA {
+	l := c.layout()
+	img := image.NewRGBA(image.Rect(0, 0, width, l.height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	c.drawTimeAxis(img, l)
+	if len(c.Series) > 0 {
+		c.drawSeries(img, l)
+	}
+	for i, timeline := range c.Timelines {
+		c.drawTimeline(img, l, timeline, l.timelinesTop+i*rowHeight)
+	}
+	return img
+}
+
+func (c *Chart) layout() layout {
+	l := layout{start: c.Start, location: c.Location, right: width - margin}
+	if l.location == nil {
+		l.location = time.Local
+	}
+	l.seconds = c.End.Sub(c.Start).Seconds()
+	if l.seconds <= 0 {
+		l.seconds = 1
+	}
+
+	labelArea := minLabelArea
+	for _, timeline := range c.Timelines {
+		labelArea = max(labelArea, len([]rune(timeline.Name))*charWidth+margin)
+	}
+	l.left = margin + min(labelArea, maxLabelArea)
+
+	y := margin
+	if len(c.Series) > 0 {
+		y += legendHeight
+		l.plotTop = y
+		y += plotHeight
+		l.plotBottom = y
+		l.minY, l.maxY, l.yStep = c.valueRange()
+	}
+	l.timelinesTop = y
+	y += len(c.Timelines) * rowHeight
+	l.axisTop = y
+	l.height = y + axisHeight + margin
+	return l
+}
+
+// valueRange returns the y axis range, widened to whole ticks, and the tick step.
+func (c *Chart) valueRange() (float64, float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, series := range c.Series {
+		for _, point := range series.Points {
+			if !math.IsNaN(point.Value) {
+				low = math.Min(low, point.Value)
+				high = math.Max(high, point.Value)
+			}
+		}
+	}
+	if math.IsInf(low, 0) {
+		low, high = 0, 1
+	}
+	if high-low < 1e-9 {
+		low, high = low-1, high+1
+	}
+
+	step := niceStep((high - low) / 4)
+	return math.Floor(low/step) * step, math.Ceil(high/step) * step, step
+}
+
+// niceStep rounds a tick step up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, factor := range []float64{1, 2, 5, 10} {
+		if raw <= factor*magnitude {
+			return factor * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func (l layout) x(t time.Time) int {
+	fraction := t.Sub(l.start).Seconds() / l.seconds
+	fraction = math.Max(0, math.Min(1, fraction))
+	return l.left + int(math.Round(fraction*float64(l.right-l.left)))
+}
+
+func (l layout) y(value float64) int {
+	fraction := (value - l.minY) / (l.maxY - l.minY)
+	return l.plotBottom - int(math.Round(fraction*float64(l.plotBottom-l.plotTop)))
+}
+
+// drawTimeAxis draws vertical grid lines and time labels.
+func (c *Chart) drawTimeAxis(img *image.RGBA, l layout) {
+	top := l.plotTop
+	if len(c.Series) == 0 {
+		top = l.timelinesTop
+	}
+
+	step := tickStep(c.End.Sub(c.Start))
+	for t := firstTick(c.Start, step, l.location); !t.After(c.End); t = t.Add(step) {
+		x := l.x(t)
+		vline(img, x, top, l.axisTop, gridColor)
+
+		label := t.In(l.location).Format("15:04")
+		if step >= 24*time.Hour || (t.In(l.location).Hour() == 0 && t.In(l.location).Minute() == 0) {
+			label = t.In(l.location).Format("Jan 2")
+		}
+		x -= len(label) * charWidth / 2
+		x = max(l.left, min(x, l.right-len(label)*charWidth))
+		drawText(img, x, l.axisTop+15, label, mutedColor)
+	}
+	hline(img, l.left, l.right, l.axisTop, mutedColor)
+}
+
+// tickStep returns the interval between time labels.
+func tickStep(d time.Duration) time.Duration {
+	for _, step := range []time.Duration{
+		15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour,
+		12 * time.Hour, 24 * time.Hour, 48 * time.Hour, 7 * 24 * time.Hour,
+	} {
+		if d/step <= maxTicks {
+			return step
+		}
+	}
+	return 30 * 24 * time.Hour
+}
+
+// firstTick returns the first multiple of step after local midnight at or
+// after start.
+func firstTick(start time.Time, step time.Duration, location *time.Location) time.Time {
+	local := start.In(location)
+	t := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	for t.Before(start) {
+		t = t.Add(step)
+	}
+	return t
+}
+
+// drawSeries draws the y axis, the lines and their legend.
+func (c *Chart) drawSeries(img *image.RGBA, l layout) {
+	for value := l.minY; value <= l.maxY+l.yStep/2; value += l.yStep {
+		y := l.y(value)
+		hline(img, l.left, l.right, y, gridColor)
+		label := formatValue(value, l.yStep)
+		drawText(img, l.left-6-len(label)*charWidth, y+4, label, mutedColor)
+	}
+
+	legendX := l.left
+	for i, series := range c.Series {
+		col := palette[i%len(palette)]
+		for j, point := range series.Points {
+			if math.IsNaN(point.Value) {
+				continue
+			}
+			x, y := l.x(point.Time), l.y(point.Value)
+			next := l.right
+			if j+1 < len(series.Points) {
+				next = l.x(series.Points[j+1].Time)
+			}
+			thickLine(img, x, y, next, y, col)
+			if j+1 < len(series.Points) && !math.IsNaN(series.Points[j+1].Value) {
+				thickLine(img, next, y, next, l.y(series.Points[j+1].Value), col)
+			}
+		}
+
+		label := series.Name
+		if series.Unit != "" {
+			label += " (" + series.Unit + ")"
+		}
+		if legendX+14+len([]rune(label))*charWidth > l.right {
+			continue
+		}
+		fill(img, image.Rect(legendX, margin+3, legendX+10, margin+13), col)
+		drawText(img, legendX+14, margin+12, label, textColor)
+		legendX += 14 + len([]rune(label))*charWidth + 16
+	}
+}
+
+// drawTimeline draws one binary sensor's bar, labelled with its name and
+// total on time, with the length of each on period where it fits.
+func (c *Chart) drawTimeline(img *image.RGBA, l layout, timeline Timeline, top int) {
+	name := timeline.Name
+	if maxRunes := (l.left - margin - 8) / charWidth; len([]rune(name)) > maxRunes {
+		name = string([]rune(name)[:maxRunes-1]) + "~"
+	}
+	drawText(img, margin, top+13, name, textColor)
+	drawText(img, margin, top+27, "on "+formatDuration(timeline.OnFor()), mutedColor)
+
+	barTop, barBottom := top+6, top+rowHeight-6
+	fill(img, image.Rect(l.left, barTop, l.right, barBottom), offColor)
+	for _, span := range timeline.Spans {
+		x0, x1 := l.x(span.Start), l.x(span.End)
+		switch {
+		case span.Unavailable:
+			fill(img, image.Rect(x0, barTop, max(x1, x0+1), barBottom), noneColor)
+		case span.On:
+			fill(img, image.Rect(x0, barTop, max(x1, x0+1), barBottom), onColor)
+			label := formatDuration(span.End.Sub(span.Start))
+			if x1-x0 >= len(label)*charWidth+6 {
+				drawText(img, (x0+x1-len(label)*charWidth)/2, barTop+14, label, background)
+			}
+		}
+	}
+}
+
+// formatValue formats a y axis label with as many decimals as the step needs.
+func formatValue(value, step float64) string {
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+	}
+	return fmt.Sprintf("%.*f", decimals, value)
+}
+
+// formatDuration renders a duration with its two largest units, e.g. "2h5m".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	default:
+		return fmt.Sprintf("%dd%dh", int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour))
+	}
+}
+
+func drawText(img *image.RGBA, x, y int, text string, col color.Color) {
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(col), Face: basicfont.Face7x13, Dot: fixed.P(x, y)}
+	d.DrawString(ascii(text))
+}
+
+// ascii folds text to the ASCII characters basicfont has glyphs for: accents
+// are dropped, so "Dveře" becomes "Dvere", as is the degree sign of units.
+func ascii(text string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		switch {
+		case r < utf8.RuneSelf:
+			sb.WriteRune(r)
+		case unicode.Is(unicode.Mn, r), r == '°':
+		default:
+			sb.WriteRune('?')
+		}
+	}
+	return sb.String()
+}
+
+func fill(img *image.RGBA, r image.Rectangle, col color.Color) {
+	draw.Draw(img, r, image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+func hline(img *image.RGBA, x0, x1, y int, col color.Color) {
+	fill(img, image.Rect(x0, y, x1+1, y+1), col)
+}
+
+func vline(img *image.RGBA, x, y0, y1 int, col color.Color) {
+	fill(img, image.Rect(x, y0, x+1, y1+1), col)
+}
+
+// thickLine draws a two pixel wide line.
+func thickLine(img *image.RGBA, x0, y0, x1, y1 int, col color.RGBA) {
+	steps := max(abs(x1-x0), abs(y1-y0), 1)
+	for i := 0; i <= steps; i++ {
+		x := x0 + (x1-x0)*i/steps
+		y := y0 + (y1-y0)*i/steps
+		img.SetRGBA(x, y, col)
+		img.SetRGBA(x+1, y, col)
+		img.SetRGBA(x, y+1, col)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"hasscord/hass"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxChoices is the number of autocomplete choices Discord displays.
+const maxChoices = 25
+
+// entityChoices returns entity IDs from the state cache containing value,
+// optionally limited to the given domains.
+func entityChoices(client *hass.Client, value string, domains ...string) []*discordgo.ApplicationCommandOptionChoice {
+	if client == nil {
+		return nil
+	}
+
+	value = strings.ToLower(value)
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, state := range client.States.All() {
+		if len(domains) > 0 {
+			domain, _, _ := strings.Cut(state.EntityID, ".")
+			if !contains(domains, domain) {
+				continue
+			}
+		}
+
+		name, _ := state.Attributes["friendly_name"].(string)
+		if !strings.Contains(state.EntityID, value) && !strings.Contains(strings.ToLower(name), value) {
+			continue
+		}
+
+		label := state.EntityID
+		if name != "" {
+			label = name + " (" + state.EntityID + ")"
+		}
+		label = truncate(label, 100)
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: label, Value: state.EntityID})
+		if len(choices) == maxChoices {
+			break
+		}
+	}
+	return choices
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
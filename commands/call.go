@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"hasscord/bot"
+	"hasscord/hass"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commonServices are suggested when autocompleting the service option.
+var commonServices = []string{
+	"automation.trigger",
+	"cover.close_cover",
+	"cover.open_cover",
+	"homeassistant.toggle",
+	"homeassistant.turn_off",
+	"homeassistant.turn_on",
+	"light.turn_off",
+	"light.turn_on",
+	"lock.lock",
+	"lock.unlock",
+	"scene.turn_on",
+	"script.turn_on",
+	"switch.turn_off",
+	"switch.turn_on",
+}
+
+// Call represents the command for calling Home Assistant services.
+type Call struct {
+	HassClient *hass.Client
+}
+
+// Name returns the command's name.
+func (c *Call) Name() string {
+	return "call"
+}
+
+// Capability returns the permission needed to run the command.
+func (c *Call) Capability() bot.Capability {
+	return bot.CapabilityControl
+}
+
+// Description returns the slash command description.
+func (c *Call) Description() string {
+	return "Call a Home Assistant service on an entity"
+}
+
+// Usage returns the command's arguments for help.
+func (c *Call) Usage() string {
+	return "<domain>.<service> <entity> [key=value...]"
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (c *Call) Examples() []string {
+	return []string{
+		"call light.turn_on light.kitchen brightness=128",
+		"call lock.lock lock.front_door",
+	}
+}
+
+// Options returns the slash command options.
+func (c *Call) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "service",
+			Description:  "Service to call, e.g. light.turn_off",
+			Required:     true,
+			Autocomplete: true,
+		},
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "entity",
+			Description:  "Target entity ID",
+			Required:     true,
+			Autocomplete: true,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "data",
+			Description: "Service data as key=value pairs separated by spaces",
+		},
+	}
+}
+
+// Autocomplete suggests entity IDs for the entity option and common services
+// for the service option. Autocomplete only sees the focused option, so
+// services aren't filtered by the entity's domain.
+func (c *Call) Autocomplete(option, value string) []*discordgo.ApplicationCommandOptionChoice {
+	switch option {
+	case "entity":
+		return entityChoices(c.HassClient, value)
+	case "service":
+		var choices []*discordgo.ApplicationCommandOptionChoice
+		for _, service := range commonServices {
+			if strings.Contains(service, strings.ToLower(value)) {
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: service, Value: service})
+			}
+		}
+		return choices
+	}
+	return nil
+}
+
+// Execute runs the command.
+func (c *Call) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
+	if c.HassClient == nil {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Error:** Home Assistant client not initialized.")
+		return
+	}
+
+	if len(args) < 2 {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Usage:** `!call <domain>.<service> <entity> [key=value...]`\n\nExample: `!call light.turn_on light.kitchen brightness=128`")
+		return
+	}
+
+	domain, service, ok := strings.Cut(args[0], ".")
+	if !ok || domain == "" || service == "" {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Invalid service: `%s`**\n\nServices are written as `<domain>.<service>`, e.g. `lock.lock`.", args[0]))
+		return
+	}
+
+	target := &hass.Target{EntityID: []string{args[1]}}
+
+	data, err := parseServiceData(args[2:])
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = c.HassClient.CallService(ctx, domain, service, target, data)
+	if err != nil {
+		log.Printf("Error calling service %s.%s: %v", domain, service, err)
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** %v", err))
+		return
+	}
+
+	log.Printf("User %s called %s.%s on %s", authorName(m), domain, service, args[1])
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("✅ Called `%s.%s` on `%s`.", domain, service, args[1]))
+}
+
+// parseServiceData turns key=value arguments into service data. Values that
+// are valid JSON (numbers, booleans, lists) keep their type, anything else is
+// passed as a string.
+func parseServiceData(args []string) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(args))
+	for _, arg := range args {
+		key, raw, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid argument `%s`, expected `key=value`", arg)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		data[key] = value
+	}
+	return data, nil
+}
+
+// authorName returns a printable name for the author of a message.
+func authorName(m *discordgo.MessageCreate) string {
+	if m.Author == nil {
+		return "unknown"
+	}
+	return m.Author.Username
+}
+
+// rawArgs returns the message text after the command name, with the newlines
+// and spacing that splitting it into args loses. It reports false if the
+// message doesn't contain the command name.
+func rawArgs(m *discordgo.MessageCreate, name string) (string, bool) {
+	if m.Message == nil {
+		return "", false
+	}
+	_, rest, ok := strings.Cut(m.Content, name)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
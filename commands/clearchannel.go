@@ -20,6 +20,31 @@ func (c *ClearChannel) Name() string {
 	return "clear"
 }
 
+// Capability returns the permission needed to run the command.
+func (c *ClearChannel) Capability() bot.Capability {
+	return bot.CapabilityAdmin
+}
+
+// Description returns the slash command description.
+func (c *ClearChannel) Description() string {
+	return "Delete all messages in the alert channel"
+}
+
+// Usage returns the command's arguments for help.
+func (c *ClearChannel) Usage() string {
+	return ""
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (c *ClearChannel) Examples() []string {
+	return nil
+}
+
+// Options returns the slash command options.
+func (c *ClearChannel) Options() []*discordgo.ApplicationCommandOption {
+	return nil
+}
+
 // Execute runs the command.
 func (c *ClearChannel) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
 	if m.ChannelID != c.Config.ChannelID {
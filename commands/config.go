@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"hasscord/bot"
+	"hasscord/config"
+	"hasscord/hass"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxErrorLogLength limits how much of the end of Home Assistant's error
+// log is shown, keeping the message within Discord's limit.
+const maxErrorLogLength = 1800
+
+// Config represents the command for managing the bot configuration and
+// checking Home Assistant's.
+type Config struct {
+	Config     *config.Config
+	Reloader   *config.Reloader
+	RESTClient *hass.RESTClient
+}
+
+// Name returns the command's name.
+func (c *Config) Name() string {
+	return "config"
+}
+
+// Capability returns the permission needed to run the command.
+func (c *Config) Capability() bot.Capability {
+	return bot.CapabilityAdmin
+}
+
+// Description returns the slash command description.
+func (c *Config) Description() string {
+	return "Show or reload the bot configuration, or check Home Assistant's"
+}
+
+// Usage returns the command's arguments for help.
+func (c *Config) Usage() string {
+	return "[reload|check|log]"
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (c *Config) Examples() []string {
+	return []string{
+		"config",
+		"config reload",
+		"config check",
+		"config log",
+	}
+}
+
+// Options returns the slash command options.
+func (c *Config) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "action",
+		Description: "reload the config file, check or log Home Assistant's, empty to show a summary",
+		Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "reload", Value: "reload"},
+			{Name: "check", Value: "check"},
+			{Name: "log", Value: "log"},
+		},
+	}}
+}
+
+// Execute runs the command.
+func (c *Config) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("⚙️ **Configuration:** %s\n\nUse `!config reload` to reload the config file.", c.Config))
+		return
+	}
+
+	action := strings.ToLower(args[0])
+
+	switch action {
+	case "reload":
+		if c.Reloader == nil {
+			s.ChannelMessageSend(m.ChannelID, "ℹ️ **No config file**\n\nThe bot is configured from environment variables only, there is nothing to reload.")
+			return
+		}
+
+		err := c.Reloader.Reload()
+		if err != nil {
+			log.Printf("Error reloading configuration: %v", err)
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Reload failed**, keeping the previous configuration:\n```\n%v\n```", err))
+			return
+		}
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("✅ **Configuration reloaded:** %s", c.Config))
+
+	case "check":
+		c.checkHass(s, m)
+
+	case "log":
+		c.hassErrorLog(s, m)
+
+	default:
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Invalid action: `%s`**\n\nValid actions:\n• `!config` - Show a configuration summary\n• `!config reload` - Reload the config file\n• `!config check` - Check Home Assistant's configuration\n• `!config log` - Show the end of Home Assistant's error log", action))
+	}
+}
+
+// checkHass runs Home Assistant's configuration check and reports the result.
+func (c *Config) checkHass(s bot.Messager, m *discordgo.MessageCreate) {
+	if c.RESTClient == nil {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Error:** Home Assistant client not initialized.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	check, err := c.RESTClient.CheckConfig(ctx)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** %v", err))
+		return
+	}
+
+	// Errors and warnings share the space when there are both.
+	limit := maxErrorLogLength
+	if !check.Valid() && check.Warnings != "" {
+		limit /= 2
+	}
+	var msg string
+	if check.Valid() {
+		msg = "✅ **Home Assistant configuration is valid.**"
+	} else {
+		msg = fmt.Sprintf("❌ **Home Assistant configuration is invalid:**\n```\n%s\n```", truncate(check.Errors, limit))
+	}
+	if check.Warnings != "" {
+		msg += fmt.Sprintf("\n⚠️ **Warnings:**\n```\n%s\n```", truncate(check.Warnings, limit))
+	}
+	_, err = s.ChannelMessageSend(m.ChannelID, msg)
+	if err != nil {
+		log.Printf("Error sending configuration check: %v", err)
+	}
+}
+
+// hassErrorLog posts the last lines of Home Assistant's error log.
+func (c *Config) hassErrorLog(s bot.Messager, m *discordgo.MessageCreate) {
+	if c.RESTClient == nil {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Error:** Home Assistant client not initialized.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	text, err := c.RESTClient.ErrorLog(ctx)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** %v", err))
+		return
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		s.ChannelMessageSend(m.ChannelID, "✅ **Home Assistant's error log is empty.**")
+		return
+	}
+	_, err = s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("📜 **Home Assistant error log:**\n```\n%s\n```", tail(text, maxErrorLogLength)))
+	if err != nil {
+		log.Printf("Error sending error log: %v", err)
+	}
+}
+
+// tail returns the last whole lines of text that fit in n bytes, or the end
+// of the last line if it alone is longer.
+func tail(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	start := len(text) - n
+	if i := strings.IndexByte(text[start:], '\n'); i >= 0 && start+i+1 < len(text) {
+		return text[start+i+1:]
+	}
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return text[start:]
+}
@@ -0,0 +1,252 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"hasscord/bot"
+	"hasscord/charts"
+	"hasscord/hass"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Limits of !graph.
+const (
+	defaultGraphSince = 24 * time.Hour
+	maxGraphEntities  = 8
+)
+
+// binaryDomains are drawn as on/off timelines rather than lines.
+var binaryDomains = []string{"binary_sensor", "input_boolean", "switch", "light", "fan"}
+
+// Graph represents the command drawing history charts of entities.
+type Graph struct {
+	HassClient *hass.Client
+}
+
+// Name returns the command's name.
+func (g *Graph) Name() string {
+	return "graph"
+}
+
+// Capability returns the permission needed to run the command.
+func (g *Graph) Capability() bot.Capability {
+	return bot.CapabilityView
+}
+
+// Description returns the slash command description.
+func (g *Graph) Description() string {
+	return "Draw a chart of entities' history"
+}
+
+// Usage returns the command's arguments for help.
+func (g *Graph) Usage() string {
+	return "<entity...> [since]"
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (g *Graph) Examples() []string {
+	return []string{
+		"graph sensor.outdoor_temperature sensor.living_room_temperature",
+		"graph binary_sensor.dvere_vchod binary_sensor.dvere_zadni 7d",
+	}
+}
+
+// Options returns the slash command options.
+func (g *Graph) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "entities",
+			Description:  "Entity IDs separated by spaces",
+			Required:     true,
+			Autocomplete: true,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "since",
+			Description: "How far back to draw, e.g. 6h or 7d (default 24h)",
+		},
+	}
+}
+
+// Autocomplete suggests entity IDs for the last entity of the entities option.
+func (g *Graph) Autocomplete(option, value string) []*discordgo.ApplicationCommandOptionChoice {
+	if option != "entities" {
+		return nil
+	}
+
+	prefix, last := "", value
+	if i := strings.LastIndex(value, " "); i >= 0 {
+		prefix, last = value[:i+1], value[i+1:]
+	}
+	choices := entityChoices(g.HassClient, last)
+	for _, choice := range choices {
+		entityID := choice.Value.(string)
+		choice.Value = prefix + entityID
+		if prefix != "" {
+			choice.Name = prefix + entityID
+		}
+		choice.Name = truncate(choice.Name, 100)
+	}
+	return choices
+}
+
+// Execute runs the command.
+func (g *Graph) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
+	if g.HassClient == nil {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Error:** Home Assistant client not initialized.")
+		return
+	}
+
+	since := defaultGraphSince
+	if len(args) > 1 {
+		if d, err := parseSince(args[len(args)-1]); err == nil {
+			since = d
+			args = args[:len(args)-1]
+		}
+	}
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Usage:** `!graph <entity...> [since]`\n\nExample: `!graph sensor.outdoor_temperature 7d`")
+		return
+	}
+	if len(args) > maxGraphEntities {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Too many entities.** A graph can show up to %d.", maxGraphEntities))
+		return
+	}
+
+	var current []hass.State
+	for _, arg := range args {
+		state, ok := g.HassClient.States.Get(strings.ToLower(arg))
+		if !ok {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Unknown entity** `%s`.", arg))
+			return
+		}
+		current = append(current, state)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	end := time.Now()
+	start := end.Add(-since)
+	entityIDs := make([]string, 0, len(current))
+	for _, state := range current {
+		entityIDs = append(entityIDs, state.EntityID)
+	}
+	history, err := g.HassClient.History(ctx, start, end, entityIDs...)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** %v", err))
+		return
+	}
+
+	chart := &charts.Chart{Start: start, End: end}
+	var names []string
+	for _, state := range current {
+		states := history[state.EntityID]
+		if len(states) == 0 {
+			// Entities the recorder excludes have no history, only a state.
+			states = []hass.State{state}
+		}
+
+		if isBinary(state.EntityID, states) {
+			chart.Timelines = append(chart.Timelines, timeline(friendlyName(state), states, start, end))
+		} else {
+			series, ok := series(state, states, start)
+			if !ok {
+				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **`%s` is not numeric** and can't be drawn.", state.EntityID))
+				return
+			}
+			chart.Series = append(chart.Series, series)
+		}
+		names = append(names, "**"+friendlyName(state)+"**")
+	}
+
+	var image bytes.Buffer
+	err = chart.EncodePNG(&image)
+	if err != nil {
+		log.Printf("Error rendering graph: %v", err)
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** %v", err))
+		return
+	}
+
+	_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("📈 %s since <t:%d:f>", strings.Join(names, ", "), start.Unix()),
+		Files:   []*discordgo.File{{Name: "graph.png", ContentType: "image/png", Reader: &image}},
+	})
+	if err != nil {
+		log.Printf("Error sending graph: %v", err)
+	}
+}
+
+// isBinary reports whether an entity is drawn as an on/off timeline: it is
+// in a binary domain, or all its states are on or off.
+func isBinary(entityID string, states []hass.State) bool {
+	domain, _, _ := strings.Cut(entityID, ".")
+	if contains(binaryDomains, domain) {
+		return true
+	}
+	for _, state := range states {
+		if state.State != "on" && state.State != "off" && !unavailable(state.State) {
+			return false
+		}
+	}
+	return true
+}
+
+// timeline converts a binary entity's history to spans between start and end.
+func timeline(name string, states []hass.State, start, end time.Time) charts.Timeline {
+	result := charts.Timeline{Name: name}
+	for i, state := range states {
+		from := state.LastChangedTime()
+		if from.Before(start) {
+			from = start
+		}
+		to := end
+		if i+1 < len(states) {
+			to = states[i+1].LastChangedTime()
+		}
+		result.Spans = append(result.Spans, charts.Span{
+			Start:       from,
+			End:         to,
+			On:          state.State == "on",
+			Unavailable: unavailable(state.State),
+		})
+	}
+	return result
+}
+
+// series converts a numeric entity's history to points, reporting false if
+// no state is a number.
+func series(current hass.State, states []hass.State, start time.Time) (charts.Series, bool) {
+	result := charts.Series{Name: friendlyName(current)}
+	result.Unit, _ = current.Attributes["unit_of_measurement"].(string)
+
+	numeric := false
+	for _, state := range states {
+		at := state.LastChangedTime()
+		if at.Before(start) {
+			at = start
+		}
+		value, err := strconv.ParseFloat(state.State, 64)
+		if err != nil {
+			value = math.NaN()
+		} else {
+			numeric = true
+		}
+		result.Points = append(result.Points, charts.Point{Time: at, Value: value})
+	}
+	return result, numeric
+}
+
+// unavailable reports whether a state means the entity has no value.
+func unavailable(state string) bool {
+	return state == "unavailable" || state == "unknown"
+}
@@ -0,0 +1,280 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"hasscord/bot"
+	"hasscord/hass"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Defaults and limits of !history.
+const (
+	defaultHistorySince = 24 * time.Hour
+	maxHistoryLines     = 25
+	maxHistoryLength    = 1900
+	// logbookTolerance is how far apart a state change and its logbook entry
+	// may be timestamped.
+	logbookTolerance = 2 * time.Second
+)
+
+// History represents the command showing an entity's recent state changes.
+type History struct {
+	HassClient *hass.Client
+}
+
+// Name returns the command's name.
+func (h *History) Name() string {
+	return "history"
+}
+
+// Capability returns the permission needed to run the command.
+func (h *History) Capability() bot.Capability {
+	return bot.CapabilityView
+}
+
+// Description returns the slash command description.
+func (h *History) Description() string {
+	return "Show when an entity changed state and who changed it"
+}
+
+// Usage returns the command's arguments for help.
+func (h *History) Usage() string {
+	return "<entity> [since]"
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (h *History) Examples() []string {
+	return []string{
+		"history binary_sensor.dvere_zadni",
+		"history lock.front_door 7d",
+	}
+}
+
+// Options returns the slash command options.
+func (h *History) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "entity",
+			Description:  "Entity ID, e.g. binary_sensor.back_door",
+			Required:     true,
+			Autocomplete: true,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "since",
+			Description: "How far back to look, e.g. 2h or 7d (default 24h)",
+		},
+	}
+}
+
+// Autocomplete suggests entity IDs for the entity option.
+func (h *History) Autocomplete(option, value string) []*discordgo.ApplicationCommandOptionChoice {
+	if option != "entity" {
+		return nil
+	}
+	return entityChoices(h.HassClient, value)
+}
+
+// Execute runs the command.
+func (h *History) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
+	if h.HassClient == nil {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Error:** Home Assistant client not initialized.")
+		return
+	}
+	if len(args) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Usage:** `!history <entity> [since]`\n\nExample: `!history binary_sensor.dvere_zadni 7d`")
+		return
+	}
+
+	entityID := strings.ToLower(args[0])
+	since := defaultHistorySince
+	if len(args) > 1 {
+		var err error
+		since, err = parseSince(args[1])
+		if err != nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **%v**\n\nUse a duration like `2h`, `30m` or `7d`.", err))
+			return
+		}
+	}
+
+	current, ok := h.HassClient.States.Get(entityID)
+	if !ok {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Unknown entity** `%s`.", entityID))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	end := time.Now()
+	start := end.Add(-since)
+	history, err := h.HassClient.History(ctx, start, end, entityID)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** %v", err))
+		return
+	}
+	// The logbook only adds who made each change, so the timeline is shown without it.
+	entries, err := h.HassClient.Logbook(ctx, start, end, entityID)
+	if err != nil {
+		log.Printf("Error getting logbook of %s: %v", entityID, err)
+	}
+
+	_, err = s.ChannelMessageSend(m.ChannelID, h.timeline(current, history[entityID], entries, start, end))
+	if err != nil {
+		log.Printf("Error sending history of %s: %v", entityID, err)
+	}
+}
+
+// timeline renders the state changes of an entity between start and end, one
+// line each with how long the state lasted and who caused it.
+func (h *History) timeline(current hass.State, states []hass.State, entries []hass.LogbookEntry, start, end time.Time) string {
+	style := "t"
+	if end.Sub(start) > 24*time.Hour {
+		style = "f"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📜 **%s** `%s` since <t:%d:%s>\n", truncate(friendlyName(current), 100), current.EntityID, start.Unix(), style))
+
+	changes := stateChanges(states)
+	if len(changes) == 0 {
+		sb.WriteString("ℹ️ No history in this period.")
+		return sb.String()
+	}
+
+	// Lines are added newest first until the message is full, and the
+	// rest are counted in a line of their own.
+	budget := maxHistoryLength - sb.Len() - len(fmt.Sprintf("… %d earlier change(s)\n", len(changes)))
+	var lines []string
+	for i := len(changes) - 1; i >= 0 && len(lines) < maxHistoryLines; i-- {
+		state := changes[i]
+		// The first state may have started before the period.
+		changed := state.LastChangedTime()
+		if changed.Before(start) {
+			changed = start
+		}
+		until, now := end, i == len(changes)-1
+		if !now {
+			until = changes[i+1].LastChangedTime()
+		}
+
+		line := fmt.Sprintf("• <t:%d:%s> **%s** for %s", changed.Unix(), style, state.State, formatElapsed(until.Sub(changed)))
+		if now {
+			line += " (now)"
+		}
+		if cause := h.cause(state, entries); cause != "" {
+			line += " · " + cause
+		}
+		line += "\n"
+		if len(line) > budget {
+			if len(lines) > 0 {
+				break
+			}
+			line = truncate(line, budget-1) + "\n"
+		}
+		budget -= len(line)
+		lines = append(lines, line)
+	}
+
+	if skipped := len(changes) - len(lines); skipped > 0 {
+		sb.WriteString(fmt.Sprintf("… %d earlier change(s)\n", skipped))
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		sb.WriteString(lines[i])
+	}
+	return sb.String()
+}
+
+// cause describes who or what caused a state change, from its logbook entry.
+func (h *History) cause(state hass.State, entries []hass.LogbookEntry) string {
+	changed := state.LastChangedTime()
+	for _, entry := range entries {
+		if entry.EntityID != state.EntityID || entry.State != state.State {
+			continue
+		}
+		if d := entry.WhenTime().Sub(changed); d < -logbookTolerance || d > logbookTolerance {
+			continue
+		}
+		switch {
+		case entry.ContextUserID != "":
+			return "👤 " + h.userName(entry.ContextUserID)
+		case entry.ContextName != "":
+			return "⚙️ " + entry.ContextName
+		case entry.ContextEntityName != "":
+			return "⚙️ " + entry.ContextEntityName
+		}
+		return ""
+	}
+	return ""
+}
+
+// userName returns the name of the person linked to a Home Assistant user,
+// or a shortened user ID if there is none.
+func (h *History) userName(userID string) string {
+	for _, state := range h.HassClient.States.All() {
+		if !strings.HasPrefix(state.EntityID, "person.") {
+			continue
+		}
+		if id, _ := state.Attributes["user_id"].(string); id == userID {
+			return friendlyName(state)
+		}
+	}
+	if len(userID) > 8 {
+		userID = userID[:8]
+	}
+	return "user `" + userID + "`"
+}
+
+// stateChanges drops the states whose value didn't change, such as
+// attribute-only updates.
+func stateChanges(states []hass.State) []hass.State {
+	var changes []hass.State
+	for _, state := range states {
+		if len(changes) > 0 && changes[len(changes)-1].State == state.State {
+			continue
+		}
+		changes = append(changes, state)
+	}
+	return changes
+}
+
+// parseSince parses how far back to look: a duration like 2h, or days like 7d.
+func parseSince(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		days, dayErr := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if !strings.HasSuffix(value, "d") || dayErr != nil {
+			return 0, fmt.Errorf("invalid duration `%s`", value)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+	return d, nil
+}
+
+// formatElapsed renders a duration with its two largest units, e.g. "2h 5m".
+func formatElapsed(d time.Duration) string {
+	if d >= time.Minute {
+		d = d.Round(time.Minute)
+	}
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	default:
+		return fmt.Sprintf("%dd %dh", int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour))
+	}
+}
@@ -3,26 +3,93 @@ package commands
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"hasscord/bot"
+	"hasscord/hass"
 	"hasscord/sensors"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-// Pause represents the pause command for door sensor notifications.
-type Pause struct{}
+// pauseHelp lists the pause command's actions, shown after errors.
+const pauseHelp = "Valid actions:\n• `!pause on` - Pause notifications for currently open doors\n• `!pause off [pattern]` - Resume notifications\n• `!pause all [duration]` - Pause everything\n• `!pause <entity|glob> [duration]` - Pause matching entities, e.g. `!pause *garaz* until 18:00`\n• `!pause` - Show current status"
+
+// Pause represents the pause command for door sensor notifications. It
+// applies to every tracker.
+type Pause struct {
+	HassClient *hass.Client
+	Trackers   []*sensors.Tracker
+}
 
 // Name returns the command's name.
 func (p *Pause) Name() string {
 	return "pause"
 }
 
+// Capability returns the permission needed to run the command.
+func (p *Pause) Capability() bot.Capability {
+	return bot.CapabilityPause
+}
+
+// Description returns the slash command description.
+func (p *Pause) Description() string {
+	return "Pause or resume door sensor notifications"
+}
+
+// Usage returns the command's arguments for help.
+func (p *Pause) Usage() string {
+	return "[on|off [pattern]|all|<entity|glob>] [duration|until HH:MM]"
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (p *Pause) Examples() []string {
+	return []string{
+		"pause",
+		"pause on",
+		"pause *garaz* 2h",
+		"pause all until 18:00",
+		"pause off *garaz*",
+	}
+}
+
+// Options returns the slash command options.
+func (p *Pause) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "target",
+			Description:  "on, off, all, or an entity ID / glob to pause; empty to show status",
+			Autocomplete: true,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "duration",
+			Description: "How long to pause, e.g. 2h or until 18:00",
+		},
+	}
+}
+
+// Autocomplete suggests actions and entity IDs for the target option.
+func (p *Pause) Autocomplete(option, value string) []*discordgo.ApplicationCommandOptionChoice {
+	if option != "target" {
+		return nil
+	}
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, action := range []string{"on", "off", "all"} {
+		if strings.HasPrefix(action, strings.ToLower(value)) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: action, Value: action})
+		}
+	}
+	return append(choices, entityChoices(p.HassClient, value)...)
+}
+
 // Execute runs the command.
 func (p *Pause) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
 	if len(args) == 0 {
 		// Show current status
-		total, paused := sensors.GetPauseStatus()
+		total, paused := p.pauseStatus()
 		if total == 0 {
 			s.ChannelMessageSend(m.ChannelID, "ℹ️ **No doors are currently open**\n\nThere are no active door sensors to pause notifications for.")
 		} else if paused == 0 {
@@ -32,6 +99,15 @@ func (p *Pause) Execute(s bot.Messager, m *discordgo.MessageCreate, args []strin
 		} else {
 			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("⚠️ **Door sensor notifications are PARTIALLY PAUSED**\n\n%d door(s) are currently open:\n• %d have notifications paused\n• %d have notifications active\n\nUse `!pause on` to pause all\nUse `!pause off` to resume all", total, paused, total-paused))
 		}
+
+		if active := p.pauses(); len(active) > 0 {
+			var sb strings.Builder
+			sb.WriteString("⏸️ **Active pauses:**\n")
+			for _, pause := range active {
+				sb.WriteString(fmt.Sprintf("• %s\n", pause))
+			}
+			s.ChannelMessageSend(m.ChannelID, sb.String())
+		}
 		return
 	}
 
@@ -39,8 +115,10 @@ func (p *Pause) Execute(s bot.Messager, m *discordgo.MessageCreate, args []strin
 
 	switch action {
 	case "on", "pause", "stop":
-		sensors.PauseNotifications()
-		total, paused := sensors.GetPauseStatus()
+		for _, tracker := range p.Trackers {
+			tracker.PauseNotifications()
+		}
+		total, paused := p.pauseStatus()
 		if paused > 0 {
 			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("🚫 **Door sensor notifications PAUSED**\n\nNotifications have been paused for %d currently open door(s).\n\nThese doors will continue to be tracked but won't send notifications until you resume them or they close naturally.", paused))
 		} else {
@@ -48,8 +126,28 @@ func (p *Pause) Execute(s bot.Messager, m *discordgo.MessageCreate, args []strin
 		}
 
 	case "off", "resume", "start":
-		sensors.ResumeNotifications()
-		total, paused := sensors.GetPauseStatus()
+		if len(args) > 1 {
+			removed := false
+			for _, tracker := range p.Trackers {
+				removed = tracker.RemovePause(args[1]) || removed
+			}
+			if removed {
+				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("▶️ **Pause removed** for `%s`.", args[1]))
+			} else {
+				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("ℹ️ **No pause found** for `%s`.", args[1]))
+			}
+			return
+		}
+
+		cleared := len(p.pauses())
+		for _, tracker := range p.Trackers {
+			tracker.ResumeNotifications()
+			tracker.ClearPauses()
+		}
+		if cleared > 0 {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("▶️ **Removed %d pause(s).**", cleared))
+		}
+		total, paused := p.pauseStatus()
 		if paused == 0 && total > 0 {
 			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("✅ **Door sensor notifications RESUMED**\n\nNotifications have been resumed for all %d currently open door(s).", total))
 		} else if total == 0 {
@@ -58,7 +156,124 @@ func (p *Pause) Execute(s bot.Messager, m *discordgo.MessageCreate, args []strin
 			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("✅ **Door sensor notifications RESUMED**\n\nNotifications have been resumed for all %d currently open door(s).", total))
 		}
 
+	case "all":
+		p.pausePattern(s, m, "*", args[1:])
+
 	default:
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Invalid action: `%s`**\n\nValid actions:\n• `!pause on` - Pause notifications for currently open doors\n• `!pause off` - Resume notifications for currently open doors\n• `!pause` - Show current status", action))
+		// Anything else must be a glob or an entity, so a typo of an action
+		// doesn't silently pause a pattern that matches nothing.
+		target := args[0]
+		if !strings.ContainsAny(target, "*?[") {
+			target = strings.ToLower(target)
+			if !p.knownEntity(target) {
+				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Unknown action or entity `%s`**\n\n%s", args[0], pauseHelp))
+				return
+			}
+		}
+		p.pausePattern(s, m, target, args[1:])
+	}
+}
+
+// knownEntity reports whether the target names an entity Home Assistant has
+// or that is tracked, by entity ID or object ID.
+func (p *Pause) knownEntity(target string) bool {
+	pause := sensors.Pause{Pattern: target}
+	if p.HassClient != nil {
+		for _, state := range p.HassClient.States.All() {
+			if pause.Matches(state.EntityID) {
+				return true
+			}
+		}
+	}
+	for _, tracker := range p.Trackers {
+		for entityID := range tracker.Sensors() {
+			if pause.Matches(entityID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pauseStatus returns how many sensors all trackers track and how many of
+// them are paused.
+func (p *Pause) pauseStatus() (int, int) {
+	total, paused := 0, 0
+	for _, tracker := range p.Trackers {
+		trackerTotal, trackerPaused := tracker.GetPauseStatus()
+		total += trackerTotal
+		paused += trackerPaused
+	}
+	return total, paused
+}
+
+// pauses returns the active pauses of all trackers, each pause that was added
+// to every tracker listed once.
+func (p *Pause) pauses() []sensors.Pause {
+	var pauses []sensors.Pause
+	seen := make(map[string]bool)
+	for _, tracker := range p.Trackers {
+		for _, pause := range tracker.Pauses() {
+			if key := pause.String(); !seen[key] {
+				seen[key] = true
+				pauses = append(pauses, pause)
+			}
+		}
+	}
+	return pauses
+}
+
+// pausePattern pauses every entity matching the pattern, including ones that open later.
+func (p *Pause) pausePattern(s bot.Messager, m *discordgo.MessageCreate, pattern string, durationArgs []string) {
+	if err := sensors.ValidatePattern(pattern); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **%v**\n\n%s", err, pauseHelp))
+		return
+	}
+
+	until, err := parseUntil(durationArgs, p.Trackers[0].Now())
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **%v**\n\nUse a duration like `2h` or `30m`, or a time like `until 18:00`.", err))
+		return
+	}
+
+	for _, tracker := range p.Trackers {
+		tracker.AddPause(pattern, until, authorName(m))
+	}
+
+	if until.IsZero() {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("🚫 **Notifications PAUSED** for `%s` until resumed.\n\nUse `!pause off %s` to resume.", pattern, pattern))
+	} else {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("🚫 **Notifications PAUSED** for `%s` until %s.\n\nThe pause also applies to doors that open in the meantime.", pattern, until.Format("Jan 2 15:04")))
+	}
+}
+
+// parseUntil turns "2h", "18:00" or "until 18:00" into an end time. No
+// arguments mean an indefinite pause, reported as the zero time.
+func parseUntil(args []string, now time.Time) (time.Time, error) {
+	if len(args) > 0 && strings.EqualFold(args[0], "until") {
+		args = args[1:]
+		if len(args) == 0 {
+			return time.Time{}, fmt.Errorf("missing time after `until`")
+		}
+	}
+	if len(args) == 0 {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(args[0]); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("duration must be positive")
+		}
+		return now.Add(d), nil
+	}
+
+	clock, err := time.ParseInLocation("15:04", args[0], now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid duration `%s`", args[0])
+	}
+	until := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !until.After(now) {
+		until = until.AddDate(0, 0, 1)
 	}
+	return until, nil
 }
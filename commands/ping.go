@@ -13,6 +13,31 @@ func (p *Ping) Name() string {
 	return "ping"
 }
 
+// Capability returns the permission needed to run the command.
+func (p *Ping) Capability() bot.Capability {
+	return bot.CapabilityView
+}
+
+// Description returns the slash command description.
+func (p *Ping) Description() string {
+	return "Check that the bot is alive"
+}
+
+// Usage returns the command's arguments for help.
+func (p *Ping) Usage() string {
+	return ""
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (p *Ping) Examples() []string {
+	return nil
+}
+
+// Options returns the slash command options.
+func (p *Ping) Options() []*discordgo.ApplicationCommandOption {
+	return nil
+}
+
 // Execute runs the command.
 func (p *Ping) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
 	s.ChannelMessageSend(m.ChannelID, "Pong!")
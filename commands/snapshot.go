@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"hasscord/bot"
+	"hasscord/hass"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Snapshot represents the command posting a camera's current image.
+type Snapshot struct {
+	HassClient *hass.Client
+	RESTClient *hass.RESTClient
+}
+
+// Name returns the command's name.
+func (c *Snapshot) Name() string {
+	return "snapshot"
+}
+
+// Capability returns the permission needed to run the command.
+func (c *Snapshot) Capability() bot.Capability {
+	return bot.CapabilityView
+}
+
+// Description returns the slash command description.
+func (c *Snapshot) Description() string {
+	return "Post a camera's current image"
+}
+
+// Usage returns the command's arguments for help.
+func (c *Snapshot) Usage() string {
+	return "<camera>"
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (c *Snapshot) Examples() []string {
+	return []string{"snapshot camera.garaz"}
+}
+
+// Options returns the slash command options.
+func (c *Snapshot) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "camera",
+			Description:  "Camera entity ID, e.g. camera.garage",
+			Required:     true,
+			Autocomplete: true,
+		},
+	}
+}
+
+// Autocomplete suggests camera entity IDs for the camera option.
+func (c *Snapshot) Autocomplete(option, value string) []*discordgo.ApplicationCommandOptionChoice {
+	if option != "camera" {
+		return nil
+	}
+	return entityChoices(c.HassClient, value, "camera")
+}
+
+// Execute runs the command.
+func (c *Snapshot) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
+	if c.RESTClient == nil {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Error:** Home Assistant client not initialized.")
+		return
+	}
+	if len(args) != 1 {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Usage:** `!snapshot <camera>`\n\nExample: `!snapshot camera.garaz`")
+		return
+	}
+
+	entityID := strings.ToLower(args[0])
+	if !strings.HasPrefix(entityID, "camera.") {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **`%s` is not a camera.**", entityID))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	image, contentType, err := c.RESTClient.CameraSnapshot(ctx, entityID)
+	if errors.Is(err, hass.ErrNotFound) {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Unknown camera** `%s`.", entityID))
+		return
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** %v", err))
+		return
+	}
+
+	name := "snapshot.jpg"
+	if contentType == "image/png" {
+		name = "snapshot.png"
+	}
+	_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("📷 `%s` at <t:%d:T>", entityID, time.Now().Unix()),
+		Files:   []*discordgo.File{{Name: name, ContentType: contentType, Reader: bytes.NewReader(image)}},
+	})
+	if err != nil {
+		log.Printf("Error sending snapshot: %v", err)
+	}
+}
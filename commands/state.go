@@ -1,21 +1,43 @@
 package commands
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"hasscord/bot"
 	"hasscord/hass"
+	"hasscord/sensors"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+// stateComponent is the component name of the state pagination buttons.
+const stateComponent = "state"
+
+// Embed limits, kept at or below Discord's maximums.
+const (
+	maxFieldLength = 1024
+	maxFields      = 25
+	maxPageLength  = 4000
+)
+
+// stateColor is the accent color of state embeds.
+const stateColor = 0x41bdf5
+
+// noArea groups entities that are not assigned to an area.
+const noArea = "No area"
+
 // State represents the state command.
 type State struct {
 	HassClient *hass.Client
+	Trackers   []*sensors.Tracker                      // whose rules pick the watched entities
+	AreaOf     func(entityID string) (hass.Area, bool) // area of an entity, nil when areas are unknown
 }
 
 // Name returns the command's name.
@@ -23,6 +45,45 @@ func (s *State) Name() string {
 	return "state"
 }
 
+// Capability returns the permission needed to run the command.
+func (s *State) Capability() bot.Capability {
+	return bot.CapabilityView
+}
+
+// Description returns the slash command description.
+func (s *State) Description() string {
+	return "Show the state of watched entities, or of entities matching a filter"
+}
+
+// Usage returns the command's arguments for help.
+func (s *State) Usage() string {
+	return "[entity glob|domain|area|device class...]"
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (s *State) Examples() []string {
+	return []string{
+		"state",
+		"state light",
+		"state binary_sensor.dvere_*",
+		"state kitchen window",
+	}
+}
+
+// Options returns the slash command options.
+func (s *State) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "filter",
+		Description: "Entity globs, domains, areas or device classes; empty for watched entities",
+	}}
+}
+
+// RegisterButtons routes the Previous/Next buttons of state messages to the command.
+func (s *State) RegisterButtons(b *bot.Bot) {
+	b.RegisterComponentUpdater(stateComponent, bot.CapabilityView, s.page)
+}
+
 // Execute runs the command.
 func (s *State) Execute(b bot.Messager, m *discordgo.MessageCreate, args []string) {
 	if s.HassClient == nil {
@@ -30,70 +91,276 @@ func (s *State) Execute(b bot.Messager, m *discordgo.MessageCreate, args []strin
 		return
 	}
 
-	// Request all states from Home Assistant
-	responseChan := make(chan hass.Message, 1)
-	id := s.HassClient.NextMessageID()
-	s.HassClient.RegisterPending(id, responseChan)
+	states, err := s.fetchStates()
+	if err != nil {
+		b.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** %v", err))
+		return
+	}
+
+	b.ChannelMessageSendComplex(m.ChannelID, s.render(states, args, 0))
+}
 
-	req := map[string]interface{}{
-		"id":   id,
-		"type": "get_states",
+// page renders another page of a state message. Args are the page number
+// followed by the filter.
+func (s *State) page(user *discordgo.User, args []string) *discordgo.MessageSend {
+	if len(args) < 2 {
+		return &discordgo.MessageSend{Content: "❌ Unknown action."}
+	}
+	page, err := strconv.Atoi(args[0])
+	if err != nil {
+		return &discordgo.MessageSend{Content: "❌ Unknown action."}
 	}
 
-	err := s.HassClient.Conn.WriteJSON(req)
+	states, err := s.fetchStates()
 	if err != nil {
-		log.Printf("Error sending get_states request: %v", err)
-		b.ChannelMessageSend(m.ChannelID, "❌ **Error:** Failed to fetch states from Home Assistant.")
-		return
+		return &discordgo.MessageSend{Content: fmt.Sprintf("❌ **Error:** %v", err)}
+	}
+	// The filter itself may have contained the custom ID separator.
+	filter := strings.Fields(strings.Join(args[1:], ":"))
+	return s.render(states, filter, page)
+}
+
+// fetchStates returns every state from the client's state cache, asking Home
+// Assistant only while the cache is still empty.
+func (s *State) fetchStates() ([]hass.State, error) {
+	if states := s.HassClient.States.All(); len(states) > 0 {
+		return states, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	states, err := s.HassClient.GetStates(ctx)
+	if err != nil {
+		log.Printf("Error fetching states: %v", err)
+		return nil, err
+	}
+	return states, nil
+}
+
+// areaGroup is the entities of one area, in display order.
+type areaGroup struct {
+	area  string
+	lines []string
+}
+
+// render builds the requested page of entities matching the filter, or of
+// watched entities when the filter is empty.
+func (s *State) render(states []hass.State, filter []string, page int) *discordgo.MessageSend {
+	var rules []*sensors.Rule
+	for _, tracker := range s.Trackers {
+		rules = append(rules, tracker.Rules()...)
 	}
 
-	select {
-	case response := <-responseChan:
-		if !response.Success {
-			log.Printf("Failed to get states: %v", response.Error.Message)
-			b.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** Failed to get states: %s", response.Error.Message))
-			return
+	groups := make(map[string]*areaGroup)
+	total := 0
+	for _, state := range sortByName(states) {
+		area := s.areaOf(state.EntityID)
+		rule := sensors.MatchRule(rules, state, area)
+		if len(filter) == 0 && rule == nil {
+			continue
+		}
+		if len(filter) > 0 && !matchesFilter(state, area, filter) {
+			continue
 		}
 
-		var states []hass.State
-		err := json.Unmarshal(response.Result, &states)
-		if err != nil {
-			log.Printf("Error unmarshaling states: %v", err)
-			b.ChannelMessageSend(m.ChannelID, "❌ **Error:** Failed to process states from Home Assistant.")
-			return
+		name := area.Name
+		if name == "" {
+			name = noArea
+		}
+		group, ok := groups[name]
+		if !ok {
+			group = &areaGroup{area: name}
+			groups[name] = group
 		}
+		group.lines = append(group.lines, entityLine(state, rule))
+		total++
+	}
 
-		var sb strings.Builder
-		var doorSensors []hass.State
+	if total == 0 {
+		if len(filter) > 0 {
+			return &discordgo.MessageSend{Content: fmt.Sprintf("ℹ️ **No entities match `%s`.**\n\nFilters can be entity globs, domains, areas or device classes.", strings.Join(filter, " "))}
+		}
+		return &discordgo.MessageSend{Content: "ℹ️ **No watched entities found.**"}
+	}
 
-		// Separate door sensors from other binary sensors
-		for _, state := range states {
-			// grab all dvere_ sensors but not the opening ones
-			if strings.HasPrefix(state.EntityID, "binary_sensor.dvere_") && !strings.HasSuffix(state.EntityID, "_opening") {
-				doorSensors = append(doorSensors, state)
-			}
+	title := "📋 Watched entities"
+	if len(filter) > 0 {
+		title = fmt.Sprintf("📋 Entities matching `%s`", strings.Join(filter, " "))
+	}
+
+	pages := paginate(sortGroups(groups))
+	page = max(0, min(page, len(pages)-1))
+
+	embed := &discordgo.MessageEmbed{
+		Title:  title,
+		Color:  stateColor,
+		Fields: pages[page],
+		Footer: &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d entities · page %d/%d", total, page+1, len(pages))},
+	}
+	msg := &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}
+
+	if len(pages) > 1 {
+		prev := bot.ComponentID(stateComponent, strconv.Itoa(page-1), strings.Join(filter, " "))
+		next := bot.ComponentID(stateComponent, strconv.Itoa(page+1), strings.Join(filter, " "))
+		if len(prev) > bot.MaxCustomID || len(next) > bot.MaxCustomID {
+			embed.Footer.Text += " · use a shorter filter to browse pages"
+			return msg
 		}
+		msg.Components = []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Previous", Style: discordgo.SecondaryButton, CustomID: prev, Disabled: page == 0},
+			discordgo.Button{Label: "Next", Style: discordgo.SecondaryButton, CustomID: next, Disabled: page == len(pages)-1},
+		}}}
+	}
+	return msg
+}
 
-		// Build door sensor section
-		if len(doorSensors) > 0 {
-			sb.WriteString("🚪 **Door Sensors:**\n")
-			for _, state := range doorSensors {
-				status := "🔒 Closed"
-				if state.State == "on" {
-					status = "🔓 Open"
-				}
-				sb.WriteString(fmt.Sprintf("• `%s`: %s\n", strings.TrimPrefix(state.EntityID, "binary_sensor."), status))
-			}
-		} else {
-			sb.WriteString("🚪 **Door Sensors:** None found\n")
+// areaOf returns the entity's area, or zero if unknown.
+func (s *State) areaOf(entityID string) hass.Area {
+	if s.AreaOf == nil {
+		return hass.Area{}
+	}
+	area, _ := s.AreaOf(entityID)
+	return area
+}
+
+// matchesFilter reports whether any filter term matches the entity as an
+// entity ID glob, domain, device class or area ID or name.
+func matchesFilter(state hass.State, area hass.Area, filter []string) bool {
+	domain, objectID, _ := strings.Cut(state.EntityID, ".")
+	deviceClass, _ := state.Attributes["device_class"].(string)
+
+	for _, term := range filter {
+		term = strings.ToLower(term)
+		if ok, _ := path.Match(term, state.EntityID); ok {
+			return true
+		}
+		if ok, _ := path.Match(term, objectID); ok {
+			return true
 		}
+		if term == domain || term == deviceClass {
+			return true
+		}
+		if sensors.MatchesArea(term, area) {
+			return true
+		}
+	}
+	return false
+}
 
-		// Add summary
-		sb.WriteString(fmt.Sprintf("\n📊 **Summary:** %d door sensor(s)", len(doorSensors)))
+// entityLine formats one entity with its status, name, state, last change and
+// key attributes.
+func entityLine(state hass.State, rule *sensors.Rule) string {
+	icon := "⚪"
+	switch {
+	case state.State == "unavailable" || state.State == "unknown":
+		icon = "⚫"
+	case rule != nil && rule.IsAlerting(state.State):
+		icon = "🔴"
+	case rule != nil:
+		icon = "🟢"
+	}
 
-		b.ChannelMessageSend(m.ChannelID, sb.String())
+	value := state.State
+	if unit, ok := state.Attributes["unit_of_measurement"].(string); ok && unit != "" {
+		value += " " + unit
+	}
 
-	case <-time.After(5 * time.Second):
-		b.ChannelMessageSend(m.ChannelID, "⏰ **Timeout:** Request timed out waiting for Home Assistant states.")
+	line := fmt.Sprintf("%s **%s** `%s` · %s", icon, friendlyName(state), state.EntityID, value)
+	if changed := state.LastChangedTime(); !changed.IsZero() {
+		line += fmt.Sprintf(" · <t:%d:R>", changed.Unix())
+	}
+	if attributes := keyAttributes(state); len(attributes) > 0 {
+		line += " · " + strings.Join(attributes, " ")
+	}
+	return truncate(line, maxFieldLength)
+}
+
+// keyAttributes formats the attributes worth showing next to the state.
+func keyAttributes(state hass.State) []string {
+	var attributes []string
+	if brightness, ok := state.Attributes["brightness"].(float64); ok && state.State == "on" {
+		attributes = append(attributes, fmt.Sprintf("💡 %.0f%%", brightness/255*100))
+	}
+	if position, ok := state.Attributes["current_position"].(float64); ok {
+		attributes = append(attributes, fmt.Sprintf("↕️ %.0f%%", position))
+	}
+	if current, ok := state.Attributes["current_temperature"].(float64); ok {
+		attributes = append(attributes, fmt.Sprintf("🌡️ %g°", current))
+	}
+	if target, ok := state.Attributes["temperature"].(float64); ok {
+		attributes = append(attributes, fmt.Sprintf("🎯 %g°", target))
+	}
+	if battery, ok := state.Attributes["battery_level"].(float64); ok {
+		attributes = append(attributes, fmt.Sprintf("🔋 %.0f%%", battery))
+	}
+	return attributes
+}
+
+// friendlyName returns the entity's friendly name, or its object ID.
+func friendlyName(state hass.State) string {
+	if name, ok := state.Attributes["friendly_name"].(string); ok && name != "" {
+		return name
+	}
+	_, objectID, _ := strings.Cut(state.EntityID, ".")
+	return objectID
+}
+
+// sortByName returns the states ordered by friendly name.
+func sortByName(states []hass.State) []hass.State {
+	sorted := append([]hass.State(nil), states...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.ToLower(friendlyName(sorted[i])) < strings.ToLower(friendlyName(sorted[j]))
+	})
+	return sorted
+}
+
+// sortGroups orders area groups by name, with entities without an area last.
+func sortGroups(groups map[string]*areaGroup) []*areaGroup {
+	sorted := make([]*areaGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if (sorted[i].area == noArea) != (sorted[j].area == noArea) {
+			return sorted[j].area == noArea
+		}
+		return sorted[i].area < sorted[j].area
+	})
+	return sorted
+}
+
+// paginate splits area groups into pages of embed fields that fit Discord's
+// embed limits. Areas too long for one field continue in the next one.
+func paginate(groups []*areaGroup) [][]*discordgo.MessageEmbedField {
+	var pages [][]*discordgo.MessageEmbedField
+	var current []*discordgo.MessageEmbedField
+	length := 0
+
+	add := func(name, value string) {
+		if len(current) == maxFields || (len(current) > 0 && length+len(name)+len(value) > maxPageLength) {
+			pages = append(pages, current)
+			current, length = nil, 0
+		}
+		current = append(current, &discordgo.MessageEmbedField{Name: name, Value: value})
+		length += len(name) + len(value)
+	}
+
+	for _, group := range groups {
+		name := group.area
+		var value strings.Builder
+		for _, line := range group.lines {
+			if value.Len() > 0 && value.Len()+len(line)+1 > maxFieldLength {
+				add(name, value.String())
+				name = group.area + " (cont.)"
+				value.Reset()
+			}
+			if value.Len() > 0 {
+				value.WriteString("\n")
+			}
+			value.WriteString(line)
+		}
+		add(name, value.String())
 	}
+	return append(pages, current)
 }
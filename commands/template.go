@@ -0,0 +1,294 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"hasscord/bot"
+	"hasscord/hass"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// templateComponent is the component name of the Stop button of watched templates.
+const templateComponent = "template"
+
+// watchFlag makes !template keep its message updated.
+const watchFlag = "--watch"
+
+// Limits of watched templates.
+const (
+	maxWatches        = 5
+	watchDuration     = time.Hour
+	watchEditInterval = 2 * time.Second // Discord rate limits message edits
+	maxResultLength   = 1900
+)
+
+// Template represents the command rendering Jinja templates in Home Assistant.
+type Template struct {
+	HassClient *hass.Client
+
+	mutex   sync.Mutex
+	watches map[string]chan struct{} // watch ID to its stop channel
+}
+
+// Name returns the command's name.
+func (t *Template) Name() string {
+	return "template"
+}
+
+// Capability returns the permission needed to run the command.
+func (t *Template) Capability() bot.Capability {
+	return bot.CapabilityView
+}
+
+// Description returns the slash command description.
+func (t *Template) Description() string {
+	return "Render a Home Assistant template, optionally keeping the result live"
+}
+
+// Usage returns the command's arguments for help.
+func (t *Template) Usage() string {
+	return "[--watch] <jinja>"
+}
+
+// Examples returns example invocations for help, without the prefix.
+func (t *Template) Examples() []string {
+	return []string{
+		"template {{ states.light | selectattr('state', 'eq', 'on') | list | count }} lights on",
+		"template --watch {{ states('sensor.outdoor_temperature') }} °C",
+	}
+}
+
+// Options returns the slash command options.
+func (t *Template) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "watch",
+			Description: "Keep the message updated as the result changes",
+			Choices:     []*discordgo.ApplicationCommandOptionChoice{{Name: "yes", Value: watchFlag}},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "template",
+			Description: "Jinja template, e.g. {{ states('sun.sun') }}",
+			Required:    true,
+		},
+	}
+}
+
+// RegisterButtons routes the Stop button of watched templates to the command.
+func (t *Template) RegisterButtons(b *bot.Bot) {
+	b.RegisterComponentHandler(templateComponent, bot.CapabilityView, t.stop)
+}
+
+// Execute runs the command.
+func (t *Template) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
+	if t.HassClient == nil {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Error:** Home Assistant client not initialized.")
+		return
+	}
+
+	// The raw text keeps the newlines and spacing that splitting into args loses.
+	text, ok := rawArgs(m, t.Name())
+	if !ok {
+		text = strings.Join(args, " ")
+	}
+	rest, watch := strings.CutPrefix(text, watchFlag)
+	if watch && rest != "" && !unicode.IsSpace([]rune(rest)[0]) {
+		rest, watch = text, false
+	}
+	template := strings.Trim(strings.TrimSpace(rest), "`")
+	if template == "" {
+		s.ChannelMessageSend(m.ChannelID, "❌ **Usage:** `!template [--watch] <jinja>`\n\nExample: `!template {{ states('sun.sun') }}`")
+		return
+	}
+
+	if watch {
+		t.watch(s, m, template)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := t.HassClient.RenderTemplate(ctx, template)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Template error:** %v", err))
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, formatResult(result))
+}
+
+// watch sends the template's result and edits it as the result changes,
+// until the Stop button is pressed or watchDuration passes.
+func (t *Template) watch(s bot.Messager, m *discordgo.MessageCreate, template string) {
+	t.mutex.Lock()
+	if len(t.watches) >= maxWatches {
+		t.mutex.Unlock()
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Error:** already watching %d templates. Stop one first.", maxWatches))
+		return
+	}
+	if t.watches == nil {
+		t.watches = make(map[string]chan struct{})
+	}
+	// IDs stay unique across restarts, so old Stop buttons can't stop new watches.
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+	stop := make(chan struct{})
+	t.watches[id] = stop
+	t.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, err := t.HassClient.SubscribeTemplate(ctx, template)
+	if err != nil {
+		t.forget(id)
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("❌ **Template error:** %v", err))
+		return
+	}
+
+	until := time.Now().Add(watchDuration)
+	msg, err := s.ChannelMessageSendComplex(m.ChannelID, watchMessage(id, "⏳ Rendering...", until))
+	if err != nil {
+		log.Printf("Error sending watched template: %v", err)
+		t.forget(id)
+		sub.Unsubscribe(context.Background())
+		return
+	}
+	log.Printf("User %s is watching template %q", authorName(m), template)
+
+	go t.follow(s, msg, id, sub, stop, until)
+}
+
+// follow edits a watched template's message with every new result, at most
+// once per watchEditInterval.
+func (t *Template) follow(s bot.Messager, msg *discordgo.Message, id string, sub *hass.Subscription, stop chan struct{}, until time.Time) {
+	defer sub.Unsubscribe(context.Background())
+	defer t.forget(id)
+
+	timeout := time.NewTimer(time.Until(until))
+	defer timeout.Stop()
+
+	var latest string
+	var throttle <-chan time.Time
+	pending := false
+	edit := func(send *discordgo.MessageSend) {
+		if send.Components == nil {
+			send.Components = []discordgo.MessageComponent{}
+		}
+		_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:         msg.ID,
+			Channel:    msg.ChannelID,
+			Content:    &send.Content,
+			Components: &send.Components,
+		})
+		if err != nil {
+			log.Printf("Error updating watched template: %v", err)
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				edit(&discordgo.MessageSend{Content: latest + "\n⏹️ Stopped: connection to Home Assistant lost."})
+				return
+			}
+			latest = formatTemplateEvent(event)
+			if throttle != nil {
+				pending = true
+				continue
+			}
+			edit(watchMessage(id, latest, until))
+			throttle = time.After(watchEditInterval)
+		case <-throttle:
+			throttle = nil
+			if pending {
+				pending = false
+				edit(watchMessage(id, latest, until))
+				throttle = time.After(watchEditInterval)
+			}
+		case <-timeout.C:
+			edit(&discordgo.MessageSend{Content: latest + "\n⏹️ Watch expired."})
+			return
+		case <-stop:
+			// The Stop button already updated the message.
+			return
+		}
+	}
+}
+
+// stop handles the Stop button of a watched template.
+func (t *Template) stop(user *discordgo.User, args []string) string {
+	if len(args) < 1 {
+		return ""
+	}
+
+	t.mutex.Lock()
+	stop, ok := t.watches[args[0]]
+	delete(t.watches, args[0])
+	t.mutex.Unlock()
+	if !ok {
+		return "⏹️ No longer watching."
+	}
+	close(stop)
+
+	who := "someone"
+	if user != nil {
+		who = user.Username
+	}
+	log.Printf("%s stopped watching template %s", who, args[0])
+	return fmt.Sprintf("⏹️ Stopped by %s.", who)
+}
+
+// forget removes a watch that ended on its own.
+func (t *Template) forget(id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.watches, id)
+}
+
+// watchMessage is the message of a watched template showing content, with
+// its Stop button.
+func watchMessage(id, content string, until time.Time) *discordgo.MessageSend {
+	return &discordgo.MessageSend{
+		Content: fmt.Sprintf("%s\n👁️ Live until <t:%d:t>", content, until.Unix()),
+		Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Stop", Style: discordgo.SecondaryButton, CustomID: bot.ComponentID(templateComponent, id)},
+		}}},
+	}
+}
+
+// formatTemplateEvent formats one rendering of a watched template.
+func formatTemplateEvent(event hass.Event) string {
+	var result hass.TemplateResult
+	err := json.Unmarshal(event.Data, &result)
+	if err != nil {
+		return fmt.Sprintf("❌ **Error:** %v", err)
+	}
+	if result.Error != "" {
+		return fmt.Sprintf("❌ **Template error:** %s", result.Error)
+	}
+	return formatResult(result.Text())
+}
+
+// formatResult shows a template result in a code block.
+func formatResult(result string) string {
+	if len(result) > maxResultLength {
+		result = truncate(result, maxResultLength) + "…"
+	}
+	if strings.TrimSpace(result) == "" {
+		return "ℹ️ The template rendered an empty result."
+	}
+	// A zero-width space keeps backticks in the result from ending the block.
+	return fmt.Sprintf("```\n%s\n```", strings.ReplaceAll(result, "```", "`\u200b``"))
+}
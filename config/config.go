@@ -1,14 +1,25 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"sync"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
-// Config stores the application's configuration.
+// defaultConfigFile is read when CONFIG_FILE is not set and the file exists.
+const defaultConfigFile = "config.yaml"
+
+// Config stores the application's configuration. Update replaces Prefix,
+// the timeouts, Rules, Schedules, Trackers and Permissions while the bot runs,
+// so once a reloader is started they must be read through CommandPrefix,
+// TrackerConfigs and Grants.
 type Config struct {
 	Token                   string
 	Prefix                  string
@@ -17,38 +28,219 @@ type Config struct {
 	ChannelID               string
 	SensorOnTimeout         int // in seconds
 	SensorOnTimeoutReminder int // in seconds
+	Rules                   []Rule
+	StateFile               string // where tracked sensors are persisted, empty to disable
+	Schedules               map[string]Schedule
+	Trackers                []TrackerConfig  // trackers alerting in other channels, besides the one of ChannelID and Rules
+	Permissions             map[string]Grant // capability name to the roles and users granted it
+	Path                    string           // config file the configuration was loaded from, empty if none
+
+	mutex sync.RWMutex // guards the settings Update changes
+}
+
+// MainTracker is the name of the tracker alerting in ChannelID with Rules.
+const MainTracker = "alerts"
+
+// TrackerConfig describes a tracker with its own alert channel and rules.
+type TrackerConfig struct {
+	Name      string              `yaml:"name"` // identifies the tracker's alert buttons and state file, so it must stay the same
+	Channel   string              `yaml:"channel"`
+	Rules     []Rule              `yaml:"rules"`
+	Schedules map[string]Schedule `yaml:"schedules"` // in addition to the global schedules
+}
+
+// Rule describes a set of entities to watch and when to alert about them.
+// Every non-empty selector must match; within a selector any value may match.
+type Rule struct {
+	Name          string       `json:"name" yaml:"name"`
+	Entities      []string     `json:"entities" yaml:"entities"`             // entity ID globs, e.g. "binary_sensor.dvere_*"
+	Regexes       []string     `json:"regexes" yaml:"regexes"`               // entity ID regular expressions
+	Domains       []string     `json:"domains" yaml:"domains"`               // e.g. "binary_sensor"
+	Areas         []string     `json:"areas" yaml:"areas"`                   // Home Assistant area IDs or names
+	DeviceClasses []string     `json:"device_classes" yaml:"device_classes"` // e.g. "door", "window"
+	Exclude       []string     `json:"exclude" yaml:"exclude"`               // entity ID globs to ignore
+	AlertState    string       `json:"alert_state" yaml:"alert_state"`       // state value that triggers alerts, defaults to "on"
+	Above         *float64     `json:"above" yaml:"above"`                   // numeric states above this alert, instead of alert_state
+	Below         *float64     `json:"below" yaml:"below"`                   // numeric states below this alert, instead of alert_state
+	Hysteresis    float64      `json:"hysteresis" yaml:"hysteresis"`         // how far back past the threshold a value must return to resolve
+	Timeout       int          `json:"timeout" yaml:"timeout"`               // in seconds
+	Reminder      int          `json:"reminder" yaml:"reminder"`             // in seconds
+	MaxReminder   int          `json:"max_reminder" yaml:"max_reminder"`     // in seconds
+	Schedule      string       `json:"schedule" yaml:"schedule"`             // name of the schedule during which the rule alerts, empty for always
+	Messages      RuleMessages `json:"messages" yaml:"messages"`
+
+	// Trigger makes the rule alert when Home Assistant fires these triggers,
+	// written as in automations, instead of watching entity states.
+	// ResolveTrigger ends the alert; without it only the initial message is sent.
+	Trigger        []map[string]interface{} `json:"trigger" yaml:"trigger"`
+	ResolveTrigger []map[string]interface{} `json:"resolve_trigger" yaml:"resolve_trigger"`
+}
+
+// RuleMessages holds the text/template strings used for a rule's alerts.
+type RuleMessages struct {
+	Initial  string `json:"initial" yaml:"initial"`
+	Reminder string `json:"reminder" yaml:"reminder"`
+	GiveUp   string `json:"give_up" yaml:"give_up"`
+	Resolved string `json:"resolved" yaml:"resolved"`
+}
+
+// Grant lists the Discord roles and users given a capability.
+type Grant struct {
+	Roles    []string `yaml:"roles"`
+	Users    []string `yaml:"users"`
+	Everyone bool     `yaml:"everyone"` // grants the capability to every user
+}
+
+// fileConfig is the layout of the YAML config file.
+type fileConfig struct {
+	Discord struct {
+		Token  string `yaml:"token"`
+		Prefix string `yaml:"prefix"`
+	} `yaml:"discord"`
+	Channels struct {
+		Alerts string `yaml:"alerts"`
+	} `yaml:"channels"`
+	Hass struct {
+		URL   string `yaml:"url"`
+		Token string `yaml:"token"`
+	} `yaml:"hass"`
+	StateFile   string              `yaml:"state_file"`
+	Rules       []Rule              `yaml:"rules"`
+	Schedules   map[string]Schedule `yaml:"schedules"`
+	Trackers    []TrackerConfig     `yaml:"trackers"`
+	Permissions map[string]Grant    `yaml:"permissions"`
 }
 
-// Load loads the configuration from environment variables.
-func Load() *Config {
+// Load loads the configuration from the config file and environment
+// variables, which override values from the file. All validation errors are
+// reported together.
+func Load() (*Config, error) {
 	// Load .env file for local development.
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("No .env file found, using environment variables.")
 	}
 
-	sensorOnTimeoutStr := getEnv("SENSOR_ON_TIMEOUT", "15")
-	sensorOnTimeout, err := strconv.Atoi(sensorOnTimeoutStr)
-	if err != nil {
-		log.Printf("Invalid SENSOR_ON_TIMEOUT value '%s', using default of 15 seconds.", sensorOnTimeoutStr)
-		sensorOnTimeout = 15
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		path = defaultConfigFile
+		if _, err := os.Stat(path); err != nil {
+			path = ""
+		}
 	}
-	sensorOnTimeoutReminderStr := getEnv("SENSOR_ON_TIMEOUT_REMINDER", "60")
-	sensorOnTimeoutReminder, err := strconv.Atoi(sensorOnTimeoutReminderStr)
-	if err != nil {
-		log.Printf("Invalid SENSOR_ON_TIMEOUT_REMINDER value '%s', using default of 60 seconds.", sensorOnTimeoutReminderStr)
-		sensorOnTimeoutReminder = 60
+
+	return LoadFile(path)
+}
+
+// LoadFile loads the configuration from the given YAML file, or from
+// environment variables only when path is empty.
+func LoadFile(path string) (*Config, error) {
+	var file fileConfig
+	if path != "" {
+		err := readFile(path, &file)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return &Config{
-		Token:                   getEnv("DISCORD_TOKEN", ""),
-		Prefix:                  getEnv("BOT_PREFIX", "!"),
-		HassURL:                 getEnv("HASS_URL", ""),
-		HassToken:               getEnv("HASS_TOKEN", ""),
-		ChannelID:               getEnv("CHANNEL_ID", ""),
+	var errs []error
+
+	sensorOnTimeout, err := getEnvInt("SENSOR_ON_TIMEOUT", 15)
+	errs = append(errs, err)
+	sensorOnTimeoutReminder, err := getEnvInt("SENSOR_ON_TIMEOUT_REMINDER", 60)
+	errs = append(errs, err)
+
+	rules := file.Rules
+	if len(rules) == 0 {
+		rules = []Rule{DefaultRule(sensorOnTimeout, sensorOnTimeoutReminder)}
+		if rulesFile := getEnv("RULES_FILE", ""); rulesFile != "" {
+			rules, err = LoadRules(rulesFile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rules file %s: %w", rulesFile, err))
+			}
+		}
+	}
+
+	cfg := &Config{
+		Token:                   getEnv("DISCORD_TOKEN", file.Discord.Token),
+		Prefix:                  getEnv("BOT_PREFIX", file.Discord.Prefix),
+		HassURL:                 getEnv("HASS_URL", file.Hass.URL),
+		HassToken:               getEnv("HASS_TOKEN", file.Hass.Token),
+		ChannelID:               getEnv("CHANNEL_ID", file.Channels.Alerts),
 		SensorOnTimeout:         sensorOnTimeout,
 		SensorOnTimeoutReminder: sensorOnTimeoutReminder,
+		Rules:                   rules,
+		StateFile:               getEnv("STATE_FILE", file.StateFile),
+		Schedules:               file.Schedules,
+		Trackers:                file.Trackers,
+		Permissions:             file.Permissions,
+		Path:                    path,
 	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "!"
+	}
+
+	errs = append(errs, cfg.Validate())
+	err = errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile strictly decodes a YAML config file, rejecting unknown keys.
+func readFile(path string, file *fileConfig) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	err = decoder.Decode(file)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// DefaultRule returns the door sensor rule used when no rules are configured.
+func DefaultRule(timeout, reminder int) Rule {
+	return Rule{
+		Name:        "doors",
+		Entities:    []string{"binary_sensor.dvere_*"},
+		Exclude:     []string{"binary_sensor.dvere_*_opening"},
+		AlertState:  "on",
+		Timeout:     timeout,
+		Reminder:    reminder,
+		MaxReminder: 3600,
+		Messages: RuleMessages{
+			Initial:  "Door `{{.Entity}}` has been open for more than {{.Timeout}} seconds! @everyone",
+			Reminder: "Reminder: Door `{{.Entity}}` is still open (open for {{.Duration}})! @everyone",
+			GiveUp:   "Door `{{.Entity}}` has been open for over {{.MaxReminder}}. Stopping reminders.",
+			Resolved: "Door `{{.Entity}}` is now closed.",
+		},
+	}
+}
+
+// LoadRules reads a JSON array of rules from a file.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rules: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules defined")
+	}
+
+	return rules, nil
 }
 
 // getEnv gets an environment variable or returns a default value.
@@ -58,3 +250,16 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt gets an integer environment variable or returns a default value.
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("invalid %s value '%s': must be a whole number of seconds", key, value)
+	}
+	return i, nil
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader reloads the configuration file when it changes or on request.
+type Reloader struct {
+	path    string
+	apply   func(*Config) error
+	mutex   sync.Mutex
+	modTime time.Time
+}
+
+// NewReloader creates a reloader for the config file at path. Apply is called
+// with every successfully loaded configuration; if it returns an error the
+// reload is reported as failed.
+func NewReloader(path string, apply func(*Config) error) *Reloader {
+	r := &Reloader{path: path, apply: apply}
+	if info, err := os.Stat(path); err == nil {
+		r.modTime = info.ModTime()
+	}
+	return r
+}
+
+// Path returns the watched config file.
+func (r *Reloader) Path() string {
+	return r.path
+}
+
+// Reload loads and applies the config file.
+func (r *Reloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if info, err := os.Stat(r.path); err == nil {
+		r.modTime = info.ModTime()
+	}
+
+	cfg, err := LoadFile(r.path)
+	if err != nil {
+		return err
+	}
+	err = r.apply(cfg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reloaded configuration from %s", r.path)
+	return nil
+}
+
+// Watch polls the config file and reloads it whenever it changes.
+func (r *Reloader) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(r.path)
+		if err != nil {
+			continue
+		}
+
+		r.mutex.Lock()
+		changed := !info.ModTime().Equal(r.modTime)
+		r.mutex.Unlock()
+		if !changed {
+			continue
+		}
+
+		err = r.Reload()
+		if err != nil {
+			log.Printf("Error reloading configuration from %s, keeping the previous one:\n%v", r.path, err)
+		}
+	}
+}
+
+// Update copies the settings that can change at runtime from newCfg. It
+// returns the settings that changed but only take effect after a restart.
+func (c *Config) Update(newCfg *Config) []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var restart []string
+	if newCfg.Token != c.Token {
+		restart = append(restart, "discord token")
+	}
+	if newCfg.HassURL != c.HassURL || newCfg.HassToken != c.HassToken {
+		restart = append(restart, "home assistant connection")
+	}
+	if newCfg.ChannelID != c.ChannelID {
+		restart = append(restart, "alert channel")
+	}
+	if newCfg.StateFile != c.StateFile {
+		restart = append(restart, "state file")
+	}
+	if !sameTrackers(newCfg.Trackers, c.Trackers) {
+		restart = append(restart, "tracker names and channels")
+	}
+
+	c.Prefix = newCfg.Prefix
+	c.SensorOnTimeout = newCfg.SensorOnTimeout
+	c.SensorOnTimeoutReminder = newCfg.SensorOnTimeoutReminder
+	c.Rules = newCfg.Rules
+	c.Schedules = newCfg.Schedules
+	c.Trackers = newCfg.Trackers
+	c.Permissions = newCfg.Permissions
+
+	return restart
+}
+
+// sameTrackers reports whether both lists have the same trackers in the same
+// channels, whatever their rules.
+func sameTrackers(a, b []TrackerConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Channel != b[i].Channel {
+			return false
+		}
+	}
+	return true
+}
+
+// TrackerConfigs returns the main tracker, alerting in ChannelID with Rules,
+// followed by the configured Trackers. Each has the global schedules added to
+// its own.
+func (c *Config) TrackerConfigs() []TrackerConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	trackers := []TrackerConfig{{Name: MainTracker, Channel: c.ChannelID, Rules: c.Rules, Schedules: c.Schedules}}
+	for _, tracker := range c.Trackers {
+		tracker.Schedules = mergeSchedules(c.Schedules, tracker.Schedules)
+		trackers = append(trackers, tracker)
+	}
+	return trackers
+}
+
+// mergeSchedules returns the global schedules with a tracker's own added,
+// replacing global ones of the same name.
+func mergeSchedules(global, own map[string]Schedule) map[string]Schedule {
+	if len(own) == 0 {
+		return global
+	}
+	merged := make(map[string]Schedule, len(global)+len(own))
+	for name, schedule := range global {
+		merged[name] = schedule
+	}
+	for name, schedule := range own {
+		merged[name] = schedule
+	}
+	return merged
+}
+
+// CommandPrefix returns the prefix of chat commands.
+func (c *Config) CommandPrefix() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.Prefix
+}
+
+// Grants returns the permission grants by capability name. The map is
+// replaced, not modified, on reload and must not be modified.
+func (c *Config) Grants() map[string]Grant {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.Permissions
+}
+
+// String summarizes the configuration without secrets.
+func (c *Config) String() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	source := c.Path
+	if source == "" {
+		source = "environment"
+	}
+	return fmt.Sprintf("%d rule(s), %d schedule(s), %d extra tracker(s), %d permission grant(s) from %s", len(c.Rules), len(c.Schedules), len(c.Trackers), len(c.Permissions), source)
+}
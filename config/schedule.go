@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule is a set of weekly time windows.
+type Schedule []Window
+
+// Window is a daily time range. A window whose From is after its To runs
+// past midnight into the next day.
+type Window struct {
+	Days []string `yaml:"days"` // mon, tue, ... sun; empty means every day
+	From string   `yaml:"from"` // HH:MM
+	To   string   `yaml:"to"`   // HH:MM
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Active reports whether t falls into any of the schedule's windows.
+func (s Schedule) Active(t time.Time) bool {
+	for _, w := range s {
+		if w.active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Window) active(t time.Time) bool {
+	from, errFrom := parseClock(w.From)
+	to, errTo := parseClock(w.To)
+	if errFrom != nil || errTo != nil {
+		return false
+	}
+
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if from <= to {
+		return w.onDay(t.Weekday()) && now >= from && now < to
+	}
+	// Overnight window: the evening part belongs to the start day, the
+	// morning part to the day before.
+	if now >= from {
+		return w.onDay(t.Weekday())
+	}
+	return now < to && w.onDay((t.Weekday()+6)%7)
+}
+
+func (w Window) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns every problem with the window.
+func (w Window) validate() []error {
+	var errs []error
+	for _, d := range w.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			errs = append(errs, fmt.Errorf("unknown day %q, use mon, tue, wed, thu, fri, sat or sun", d))
+		}
+	}
+	if _, err := parseClock(w.From); err != nil {
+		errs = append(errs, fmt.Errorf("from: %w", err))
+	}
+	if _, err := parseClock(w.To); err != nil {
+		errs = append(errs, fmt.Errorf("to: %w", err))
+	}
+	if w.From == w.To {
+		errs = append(errs, fmt.Errorf("from and to must differ"))
+	}
+	return errs
+}
+
+// parseClock parses HH:MM into the duration since midnight.
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"text/template"
+)
+
+// Capabilities that can be granted to Discord roles and users.
+var Capabilities = []string{"view", "pause", "control", "admin"}
+
+// Validate checks the whole configuration and returns every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Token == "" {
+		errs = append(errs, errors.New("discord token is required (discord.token or DISCORD_TOKEN)"))
+	}
+	if c.ChannelID == "" {
+		errs = append(errs, errors.New("alert channel is required (channels.alerts or CHANNEL_ID)"))
+	}
+	if c.HassURL == "" {
+		errs = append(errs, errors.New("home assistant URL is required (hass.url or HASS_URL)"))
+	} else if u, err := url.Parse(c.HassURL); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") {
+		errs = append(errs, fmt.Errorf("home assistant URL %q must be a ws:// or wss:// URL", c.HassURL))
+	}
+	if c.HassToken == "" {
+		errs = append(errs, errors.New("home assistant token is required (hass.token or HASS_TOKEN)"))
+	}
+
+	errs = append(errs, validateSchedules(c.Schedules)...)
+
+	for _, capability := range sortedKeys(c.Permissions) {
+		if !isCapability(capability) {
+			errs = append(errs, fmt.Errorf("permissions: unknown capability %q, use one of %v", capability, Capabilities))
+		}
+	}
+
+	errs = append(errs, validateRules(c.Rules, c.Schedules)...)
+
+	trackers := make(map[string]bool, len(c.Trackers))
+	for i, tracker := range c.Trackers {
+		name := tracker.Name
+		switch {
+		case name == "":
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Errorf("tracker %s: name is required", name))
+		case !trackerName.MatchString(name):
+			errs = append(errs, fmt.Errorf("tracker %s: name may only contain lowercase letters, digits and underscores", name))
+		case name == MainTracker:
+			errs = append(errs, fmt.Errorf("tracker %s: the name is used by the tracker of channels.alerts", name))
+		case trackers[name]:
+			errs = append(errs, fmt.Errorf("tracker %s: duplicate name", name))
+		}
+		trackers[name] = true
+
+		if tracker.Channel == "" {
+			errs = append(errs, fmt.Errorf("tracker %s: channel is required", name))
+		}
+		for _, err := range validateSchedules(tracker.Schedules) {
+			errs = append(errs, fmt.Errorf("tracker %s: %w", name, err))
+		}
+		for _, err := range validateRules(tracker.Rules, mergeSchedules(c.Schedules, tracker.Schedules)) {
+			errs = append(errs, fmt.Errorf("tracker %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// trackerName is the form of tracker names, which end up in button custom IDs
+// and file names.
+var trackerName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// validateSchedules returns every problem with the schedules.
+func validateSchedules(schedules map[string]Schedule) []error {
+	var errs []error
+	for _, name := range sortedKeys(schedules) {
+		if len(schedules[name]) == 0 {
+			errs = append(errs, fmt.Errorf("schedule %s: at least one window is required", name))
+		}
+		for i, w := range schedules[name] {
+			for _, err := range w.validate() {
+				errs = append(errs, fmt.Errorf("schedule %s window %d: %w", name, i+1, err))
+			}
+		}
+	}
+	return errs
+}
+
+// validateRules returns every problem with a tracker's rules.
+func validateRules(rules []Rule, schedules map[string]Schedule) []error {
+	var errs []error
+	if len(rules) == 0 {
+		errs = append(errs, errors.New("at least one rule is required"))
+	}
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Errorf("rule %s: name is required", name))
+		} else if names[name] {
+			errs = append(errs, fmt.Errorf("rule %s: duplicate name", name))
+		}
+		names[name] = true
+
+		for _, err := range rule.validate(schedules) {
+			errs = append(errs, fmt.Errorf("rule %s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+// validate returns every problem with the rule.
+func (r Rule) validate(schedules map[string]Schedule) []error {
+	var errs []error
+
+	hasSelector := len(r.Entities) > 0 || len(r.Regexes) > 0 || len(r.Domains) > 0 || len(r.Areas) > 0 || len(r.DeviceClasses) > 0
+	switch {
+	case len(r.Trigger) > 0 && (hasSelector || len(r.Exclude) > 0 || r.AlertState != "" || r.thresholded()):
+		errs = append(errs, errors.New("trigger rules select entities in their trigger; remove entities, regexes, domains, areas, device_classes, exclude, alert_state, above and below"))
+	case len(r.Trigger) == 0 && !hasSelector:
+		errs = append(errs, errors.New("at least one of entities, regexes, domains, areas, device_classes or trigger is required"))
+	}
+	if len(r.ResolveTrigger) > 0 && len(r.Trigger) == 0 {
+		errs = append(errs, errors.New("resolve_trigger requires trigger"))
+	}
+	triggers := map[string][]map[string]interface{}{"trigger": r.Trigger, "resolve_trigger": r.ResolveTrigger}
+	for _, name := range sortedKeys(triggers) {
+		for i, trigger := range triggers[name] {
+			_, platform := trigger["platform"]
+			_, short := trigger["trigger"] // the newer spelling of platform
+			if !platform && !short {
+				errs = append(errs, fmt.Errorf("%s %d: platform is required", name, i+1))
+			}
+		}
+	}
+
+	if r.thresholded() && r.AlertState != "" {
+		errs = append(errs, errors.New("alert_state can't be combined with above or below"))
+	}
+	if r.Above != nil && r.Below != nil && *r.Below+r.Hysteresis >= *r.Above-r.Hysteresis {
+		errs = append(errs, errors.New("with both above and below, below plus hysteresis must be less than above minus hysteresis"))
+	}
+	if r.Hysteresis < 0 {
+		errs = append(errs, errors.New("hysteresis must not be negative"))
+	} else if r.Hysteresis > 0 && !r.thresholded() {
+		errs = append(errs, errors.New("hysteresis requires above or below"))
+	}
+
+	for _, pattern := range append(append([]string(nil), r.Entities...), r.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid glob %q: %w", pattern, err))
+		}
+	}
+
+	for _, expr := range r.Regexes {
+		if _, err := regexp.Compile(expr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid regex %q: %w", expr, err))
+		}
+	}
+
+	if r.Timeout < 0 || r.Reminder < 0 || r.MaxReminder < 0 {
+		errs = append(errs, errors.New("timeout, reminder and max_reminder must not be negative"))
+	}
+
+	if r.Schedule != "" {
+		if _, ok := schedules[r.Schedule]; !ok {
+			errs = append(errs, fmt.Errorf("unknown schedule %q", r.Schedule))
+		}
+	}
+
+	messages := map[string]string{
+		"initial":  r.Messages.Initial,
+		"reminder": r.Messages.Reminder,
+		"give_up":  r.Messages.GiveUp,
+		"resolved": r.Messages.Resolved,
+	}
+	for _, name := range sortedKeys(messages) {
+		if _, err := template.New(name).Parse(messages[name]); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s message: %w", name, err))
+		}
+	}
+
+	return errs
+}
+
+// thresholded reports whether the rule alerts on numeric thresholds.
+func (r Rule) thresholded() bool {
+	return r.Above != nil || r.Below != nil
+}
+
+func isCapability(name string) bool {
+	for _, c := range Capabilities {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
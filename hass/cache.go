@@ -0,0 +1,71 @@
+package hass
+
+import (
+	"sort"
+	"sync"
+)
+
+// StateCache keeps the latest known state of every entity.
+type StateCache struct {
+	mutex  sync.RWMutex
+	states map[string]State
+}
+
+// NewStateCache creates an empty state cache.
+func NewStateCache() *StateCache {
+	return &StateCache{states: make(map[string]State)}
+}
+
+// Set stores the state of an entity.
+func (c *StateCache) Set(state State) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.states[state.EntityID] = state
+}
+
+// Delete forgets an entity.
+func (c *StateCache) Delete(entityID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.states, entityID)
+}
+
+// Replace swaps the whole cache content for the given states.
+func (c *StateCache) Replace(states []State) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.states = make(map[string]State, len(states))
+	for _, state := range states {
+		c.states[state.EntityID] = state
+	}
+}
+
+// Get returns the cached state of an entity.
+func (c *StateCache) Get(entityID string) (State, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	state, ok := c.states[entityID]
+	return state, ok
+}
+
+// All returns every cached state sorted by entity ID.
+func (c *StateCache) All() []State {
+	c.mutex.RLock()
+	states := make([]State, 0, len(c.states))
+	for _, state := range c.states {
+		states = append(states, state)
+	}
+	c.mutex.RUnlock()
+
+	sort.Slice(states, func(i, j int) bool { return states[i].EntityID < states[j].EntityID })
+	return states
+}
+
+// apply updates the cache from a state_changed event.
+func (c *StateCache) apply(data StateChangedData) {
+	if data.NewState.EntityID == "" {
+		c.Delete(data.EntityID)
+		return
+	}
+	c.Set(data.NewState)
+}
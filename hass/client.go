@@ -1,7 +1,9 @@
 package hass
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -10,14 +12,31 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+const (
+	// reconnectMinBackoff is the initial delay before redialing after a lost connection.
+	reconnectMinBackoff = 1 * time.Second
+	// reconnectMaxBackoff caps the exponential backoff between redial attempts.
+	reconnectMaxBackoff = 60 * time.Second
+)
+
 // Client represents the Home Assistant WebSocket client.
 type Client struct {
-	Conn         *websocket.Conn
-	Token        string
-	MessageID    int
-	mutex        sync.Mutex
-	pending      map[int]chan<- Message
-	eventChannel chan Event
+	Conn          *websocket.Conn
+	URL           string
+	Token         string
+	MessageID     int
+	mutex         sync.Mutex
+	writeMutex    sync.Mutex
+	pending       map[int]chan<- Message
+	subscriptions map[int]*Subscription // keyed by current request ID
+	States        *StateCache
+	Registry      *Registry
+
+	registriesLoaded   bool
+	watchingRegistries bool
+	reconnectHandlers  []func(states []State)
+	done               chan struct{}
+	closed             bool
 }
 
 // Message represents a message to/from Home Assistant.
@@ -26,11 +45,9 @@ type Message struct {
 	Type    string          `json:"type"`
 	Success bool            `json:"success,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
-	Error   *struct {
-		Code    string `json:"code"`
-		Message string `json:"message"`
-	} `json:"error,omitempty"`
-	Event *Event `json:"event,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Error   *ResultError    `json:"error,omitempty"`
+	Event   *Event          `json:"event,omitempty"`
 }
 
 // Event represents a Home Assistant event.
@@ -55,11 +72,45 @@ type State struct {
 	Attributes  map[string]interface{} `json:"attributes"`
 	LastChanged string                 `json:"last_changed"`
 	LastUpdated string                 `json:"last_updated"`
-	Context     struct {
-		ID       string `json:"id"`
-		ParentID string `json:"parent_id"`
-		UserID   string `json:"user_id"`
-	} `json:"context"`
+	Context     Context                `json:"context"`
+}
+
+// LastChangedTime parses LastChanged, returning the zero time if it is missing or invalid.
+func (s State) LastChangedTime() time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s.LastChanged)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// LastUpdatedTime parses LastUpdated, returning the zero time if it is missing or invalid.
+func (s State) LastUpdatedTime() time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s.LastUpdated)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Context identifies what caused a state change or service call.
+type Context struct {
+	ID       string `json:"id"`
+	ParentID string `json:"parent_id"`
+	UserID   string `json:"user_id"`
+}
+
+// Target selects the entities, devices or areas a service call acts on.
+type Target struct {
+	EntityID []string `json:"entity_id,omitempty"`
+	DeviceID []string `json:"device_id,omitempty"`
+	AreaID   []string `json:"area_id,omitempty"`
+}
+
+// ServiceResponse is the result of a call_service request.
+type ServiceResponse struct {
+	Context  Context         `json:"context"`
+	Response json.RawMessage `json:"response,omitempty"`
 }
 
 // New creates a new Home Assistant client.
@@ -70,14 +121,34 @@ func New(url, token string) (*Client, error) {
 	}
 
 	return &Client{
-		Conn:         conn,
-		Token:        token,
-		MessageID:    1,
-		pending:      make(map[int]chan<- Message),
-		eventChannel: make(chan Event),
+		Conn:          conn,
+		URL:           url,
+		Token:         token,
+		MessageID:     1,
+		pending:       make(map[int]chan<- Message),
+		subscriptions: make(map[int]*Subscription),
+		States:        NewStateCache(),
+		Registry:      NewRegistry(),
+		done:          make(chan struct{}),
 	}, nil
 }
 
+// conn returns the current websocket connection.
+func (c *Client) conn() *websocket.Conn {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Conn
+}
+
+// WriteJSON sends a message over the current connection. Writes are
+// serialized because the websocket library forbids concurrent writers.
+func (c *Client) WriteJSON(v interface{}) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.conn().WriteJSON(v)
+}
+
+// NextMessageID reserves the ID of the next request.
 func (c *Client) NextMessageID() int {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -86,18 +157,66 @@ func (c *Client) NextMessageID() int {
 	return id
 }
 
-func (c *Client) RegisterPending(id int, ch chan<- Message) {
+// Do sends a request and waits for its result. The request ID is assigned
+// here, so req only needs the type and its parameters. A failed result is
+// returned as a *ResultError, matching the Err* values with errors.Is. If ctx
+// ends first the request is forgotten and ctx's error is returned.
+func (c *Client) Do(ctx context.Context, req map[string]interface{}) (Message, error) {
+	return c.send(ctx, c.NextMessageID(), req)
+}
+
+// send is Do with a request ID reserved by the caller.
+func (c *Client) send(ctx context.Context, id int, req map[string]interface{}) (Message, error) {
+	if err := ctx.Err(); err != nil {
+		return Message{}, err
+	}
+
+	msg := make(map[string]interface{}, len(req)+1)
+	for k, v := range req {
+		msg[k] = v
+	}
+	msg["id"] = id
+
+	resultChan := make(chan Message, 1)
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	c.pending[id] = ch
+	c.pending[id] = resultChan
+	c.mutex.Unlock()
+
+	err := c.WriteJSON(msg)
+	if err != nil {
+		c.unregisterPending(id)
+		return Message{}, err
+	}
+
+	select {
+	case result := <-resultChan:
+		if !result.Success {
+			if result.Error == nil {
+				return result, ErrUnknownError
+			}
+			return result, result.Error
+		}
+		return result, nil
+	case <-ctx.Done():
+		c.unregisterPending(id)
+		return Message{}, ctx.Err()
+	}
 }
 
 // Authenticate authenticates the client with Home Assistant.
 func (c *Client) Authenticate() error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.authenticate(c.conn())
+}
+
+// authenticate runs the auth handshake on conn, which nothing else may use
+// until it returns.
+func (c *Client) authenticate(conn *websocket.Conn) error {
 	// Expect "auth_required"
 	var msg Message
 	log.Printf("Waiting for auth_required...")
-	err := c.Conn.ReadJSON(&msg)
+	err := conn.ReadJSON(&msg)
 	if err != nil {
 		return fmt.Errorf("error reading auth_required: %w", err)
 	}
@@ -111,19 +230,19 @@ func (c *Client) Authenticate() error {
 		"type":         "auth",
 		"access_token": c.Token,
 	}
-	err = c.Conn.WriteJSON(authMsg)
+	err = conn.WriteJSON(authMsg)
 	if err != nil {
 		return err
 	}
 
 	// Expect "auth_ok" or "auth_invalid"
-	err = c.Conn.ReadJSON(&msg)
+	err = conn.ReadJSON(&msg)
 	if err != nil {
 		return fmt.Errorf("error reading auth response: %w", err)
 	}
 	log.Printf("Received auth response type: %s", msg.Type)
 	if msg.Type == "auth_invalid" {
-		return fmt.Errorf("authentication failed: %s", msg.Error.Message)
+		return fmt.Errorf("authentication failed: %s", msg.Message)
 	}
 	if msg.Type != "auth_ok" {
 		return fmt.Errorf("unexpected message type after auth: %s", msg.Type)
@@ -134,58 +253,335 @@ func (c *Client) Authenticate() error {
 	return nil
 }
 
-// SubscribeToEvents subscribes to all events.
-func (c *Client) SubscribeToEvents() (<-chan Event, error) {
+// GetStates fetches the current state of every entity and refreshes the state cache.
+func (c *Client) GetStates(ctx context.Context) ([]State, error) {
+	result, err := c.Do(ctx, map[string]interface{}{"type": "get_states"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get states: %w", err)
+	}
+
+	var states []State
+	err = json.Unmarshal(result.Result, &states)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding states: %w", err)
+	}
+	c.States.Replace(states)
+	return states, nil
+}
+
+// OnReconnect registers a handler that is called with the current states
+// every time the client reconnects to Home Assistant.
+func (c *Client) OnReconnect(handler func(states []State)) {
 	c.mutex.Lock()
-	id := c.MessageID
-	c.MessageID++
+	defer c.mutex.Unlock()
+	c.reconnectHandlers = append(c.reconnectHandlers, handler)
+}
+
+// afterReconnect refreshes the state and registry caches and notifies
+// reconnect handlers.
+func (c *Client) afterReconnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	states, err := c.GetStates(ctx)
+	if err != nil {
+		log.Printf("Error refreshing Home Assistant states: %v", err)
+		return
+	}
+
+	c.mutex.Lock()
+	reload := c.registriesLoaded
+	c.mutex.Unlock()
+	if reload {
+		if err := c.LoadRegistries(ctx); err != nil {
+			log.Printf("Error refreshing Home Assistant registries: %v", err)
+		}
+	}
+
+	c.mutex.Lock()
+	handlers := make([]func(states []State), len(c.reconnectHandlers))
+	copy(handlers, c.reconnectHandlers)
 	c.mutex.Unlock()
 
+	for _, handler := range handlers {
+		handler(states)
+	}
+}
+
+// CallService calls a Home Assistant service. Target and data may be nil.
+func (c *Client) CallService(ctx context.Context, domain, service string, target *Target, data map[string]interface{}) (*ServiceResponse, error) {
 	req := map[string]interface{}{
-		"id":   id,
-		"type": "subscribe_events",
+		"type":    "call_service",
+		"domain":  domain,
+		"service": service,
+	}
+	if target != nil {
+		req["target"] = target
+	}
+	if len(data) > 0 {
+		req["service_data"] = data
 	}
 
-	resultChan := make(chan Message, 1)
-	c.pending[id] = resultChan
+	result, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call service %s.%s: %w", domain, service, err)
+	}
 
-	err := c.Conn.WriteJSON(req)
+	var resp ServiceResponse
+	err = json.Unmarshal(result.Result, &resp)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error decoding call_service result: %w", err)
 	}
-	log.Printf("Sent subscribe_events request with ID: %d", id)
+	return &resp, nil
+}
 
-	select {
-	case result := <-resultChan:
-		log.Printf("Received subscribe_events response: %+v", result)
-		if !result.Success {
-			return nil, fmt.Errorf("failed to subscribe to events: %s", result.Error.Message)
+// unregisterPending forgets a pending request that will not be awaited.
+func (c *Client) unregisterPending(id int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.pending, id)
+}
+
+// Listen starts listening for messages from Home Assistant. When the
+// connection drops it reconnects with exponential backoff, re-authenticates
+// and re-issues every active subscription, keeping their channels open.
+// Subscriptions Home Assistant refuses to renew are closed.
+func (c *Client) Listen() {
+	for {
+		err := c.readLoop()
+		c.failPending()
+		if c.isClosed() {
+			return
 		}
-	case <-time.After(5 * time.Second):
-		return nil, fmt.Errorf("timeout waiting for subscription result")
+		log.Printf("Error reading from WebSocket: %v", err)
+		resubscribed, ok := c.reconnect()
+		if !ok {
+			return
+		}
+		go c.checkResubscriptions(resubscribed)
+		go c.afterReconnect()
 	}
+}
 
-	return c.eventChannel, nil
+// resubscription is a subscription re-issued after a reconnect and the
+// channel its result arrives on.
+type resubscription struct {
+	sub    *Subscription
+	result chan Message
 }
 
-// Listen starts listening for messages from Home Assistant.
-func (c *Client) Listen() {
+// checkResubscriptions waits for the results of re-issued subscriptions and
+// closes those that failed, so their consumers see them end instead of
+// silently receiving nothing.
+func (c *Client) checkResubscriptions(resubscribed []resubscription) {
+	timeout := time.NewTimer(10 * time.Second)
+	defer timeout.Stop()
+
+	for _, r := range resubscribed {
+		select {
+		case result := <-r.result:
+			if result.Success {
+				continue
+			}
+			var err error = ErrUnknownError
+			if result.Error != nil {
+				err = result.Error
+			}
+			if errors.Is(err, ErrConnectionLost) {
+				// The next reconnect re-issues it again.
+				continue
+			}
+			log.Printf("Error resubscribing to %s events, closing the subscription: %v", r.sub.describe(), err)
+			c.mutex.Lock()
+			if c.subscriptions[result.ID] == r.sub {
+				delete(c.subscriptions, result.ID)
+			}
+			r.sub.close()
+			c.mutex.Unlock()
+		case <-timeout.C:
+			log.Printf("No result resubscribing to %s events", r.sub.describe())
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close closes the connection and stops Listen from reconnecting.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	for id, sub := range c.subscriptions {
+		sub.close()
+		delete(c.subscriptions, id)
+	}
+	conn := c.Conn
+	c.mutex.Unlock()
+
+	return conn.Close()
+}
+
+func (c *Client) isClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
+
+// readLoop dispatches incoming messages until the connection fails.
+func (c *Client) readLoop() error {
+	conn := c.conn()
 	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
 		var msg Message
-		err := c.Conn.ReadJSON(&msg)
+		err = json.Unmarshal(data, &msg)
 		if err != nil {
-			log.Printf("Error reading from WebSocket: %v", err)
-			close(c.eventChannel)
-			return
+			log.Printf("Error decoding Home Assistant message: %v", err)
+			continue
 		}
 
+		if msg.Type == "event" && msg.Event != nil && msg.Event.EventType == "state_changed" {
+			var data StateChangedData
+			if err := json.Unmarshal(msg.Event.Data, &data); err == nil {
+				c.States.apply(data)
+			}
+		}
+
+		// Neither send blocks: result channels hold one message and
+		// subscriptions drop old events when their consumer lags.
 		c.mutex.Lock()
-		if ch, ok := c.pending[msg.ID]; ok {
+		ch, ok := c.pending[msg.ID]
+		if ok {
 			ch <- msg
 			delete(c.pending, msg.ID)
-		} else if msg.Type == "event" {
-			c.eventChannel <- *msg.Event
+		}
+		sub := c.subscriptions[msg.ID]
+		c.mutex.Unlock()
+		if ok || sub == nil || msg.Type != "event" || msg.Event == nil {
+			continue
+		}
+
+		events := []Event{*msg.Event}
+		if sub.decode != nil {
+			events = sub.decode(data)
+		}
+		c.mutex.Lock()
+		for _, event := range events {
+			sub.deliver(event)
 		}
 		c.mutex.Unlock()
 	}
 }
+
+// failPending fails every in-flight request with ErrConnectionLost.
+func (c *Client) failPending() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for id, ch := range c.pending {
+		ch <- Message{
+			ID:      id,
+			Type:    "result",
+			Success: false,
+			Error:   ErrConnectionLost,
+		}
+		delete(c.pending, id)
+	}
+}
+
+// reconnect redials Home Assistant until it succeeds, then re-authenticates
+// and re-issues all subscriptions, returning them with their pending results.
+// It returns false if the client was closed.
+func (c *Client) reconnect() ([]resubscription, bool) {
+	backoff := reconnectMinBackoff
+	for {
+		log.Printf("Reconnecting to Home Assistant in %s...", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-c.done:
+			return nil, false
+		}
+
+		resubscribed, err := c.redial()
+		if err == nil {
+			log.Printf("Reconnected to Home Assistant.")
+			return resubscribed, true
+		}
+		log.Printf("Error reconnecting to Home Assistant: %v", err)
+
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+// redial opens a new connection and authenticates it before replacing the
+// old one, so no request is sent on an unauthenticated connection, then
+// resubscribes.
+func (c *Client) redial() ([]resubscription, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = c.authenticate(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		conn.Close()
+		return nil, errors.New("client closed")
+	}
+	old := c.Conn
+	c.Conn = conn
+
+	// Subscriptions get new request IDs on the new connection.
+	resubscribed := make([]resubscription, 0, len(c.subscriptions))
+	renewed := make(map[int]*Subscription, len(c.subscriptions))
+	for _, sub := range c.subscriptions {
+		sub.id = c.MessageID
+		c.MessageID++
+		renewed[sub.id] = sub
+		sub.snapshot = sub.entities
+
+		result := make(chan Message, 1)
+		c.pending[sub.id] = result
+		resubscribed = append(resubscribed, resubscription{sub: sub, result: result})
+	}
+	c.subscriptions = renewed
+	requests := make([]map[string]interface{}, 0, len(resubscribed))
+	for _, r := range resubscribed {
+		req := make(map[string]interface{}, len(r.sub.req)+1)
+		for k, v := range r.sub.req {
+			req[k] = v
+		}
+		req["id"] = r.sub.id
+		requests = append(requests, req)
+	}
+	c.mutex.Unlock()
+	old.Close()
+
+	for _, req := range requests {
+		err = c.WriteJSON(req)
+		if err != nil {
+			conn.Close()
+			for _, r := range resubscribed {
+				c.unregisterPending(r.sub.id)
+			}
+			return nil, fmt.Errorf("error resubscribing: %w", err)
+		}
+		log.Printf("Re-sent %s request with ID: %d", req["type"], req["id"])
+	}
+
+	return resubscribed, nil
+}
@@ -0,0 +1,227 @@
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// entitiesEvent is a subscribe_entities message: entities added with their
+// full state, changed entities as diffs, and removed entity IDs.
+type entitiesEvent struct {
+	Added   map[string]compressedState `json:"a"`
+	Changed map[string]compressedDiff  `json:"c"`
+	Removed []string                   `json:"r"`
+}
+
+// compressedState is the short form of a state used by subscribe_entities.
+// Timestamps are Unix seconds; last_updated is left out when it equals
+// last_changed.
+type compressedState struct {
+	State       string                 `json:"s"`
+	Attributes  map[string]interface{} `json:"a"`
+	Context     json.RawMessage        `json:"c"`
+	LastChanged float64                `json:"lc"`
+	LastUpdated float64                `json:"lu"`
+}
+
+// compressedDiff lists the fields of a state that changed and the attributes
+// that were removed.
+type compressedDiff struct {
+	Add struct {
+		State       *string                `json:"s"`
+		Attributes  map[string]interface{} `json:"a"`
+		Context     json.RawMessage        `json:"c"`
+		LastChanged *float64               `json:"lc"`
+		LastUpdated *float64               `json:"lu"`
+	} `json:"+"`
+	Remove struct {
+		Attributes []string `json:"a"`
+	} `json:"-,"` // the comma makes "-" a key name rather than "skip"
+}
+
+// SubscribeEntities keeps the state cache current with subscribe_entities,
+// which sends compact diffs instead of full state_changed events. It returns
+// once the cache holds every entity. The subscription's channel receives a
+// state_changed event for each change, so it can replace a state_changed
+// subscription. After a reconnect Home Assistant resends every entity, and
+// events are sent for those that changed while disconnected.
+func (c *Client) SubscribeEntities(ctx context.Context) (*Subscription, error) {
+	sub := &Subscription{
+		client:    c,
+		req:       map[string]interface{}{"type": "subscribe_entities"},
+		events:    make(chan Event, eventBuffer),
+		overflows: make(chan struct{}, 1),
+		entities:  true,
+		snapshot:  true,
+		ready:     make(chan struct{}),
+	}
+	sub.decode = func(data []byte) []Event { return c.applyEntities(sub, data) }
+	err := c.subscribe(ctx, sub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to entities: %w", err)
+	}
+
+	select {
+	case <-sub.ready:
+		return sub, nil
+	case <-ctx.Done():
+		sub.Unsubscribe(context.Background())
+		return nil, fmt.Errorf("failed to subscribe to entities: %w", ctx.Err())
+	}
+}
+
+// applyEntities updates the state cache from a subscribe_entities message and
+// returns the resulting state_changed events. Nothing is returned for the
+// first snapshot, which only seeds the cache.
+func (c *Client) applyEntities(sub *Subscription, data []byte) []Event {
+	var msg struct {
+		Event entitiesEvent `json:"event"`
+	}
+	err := json.Unmarshal(data, &msg)
+	if err != nil {
+		log.Printf("Error decoding entities event: %v", err)
+		return nil
+	}
+
+	c.mutex.Lock()
+	snapshot := sub.snapshot
+	sub.snapshot = false
+	initial := false
+	select {
+	case <-sub.ready:
+	default:
+		initial = true
+	}
+	c.mutex.Unlock()
+
+	var changes []StateChangedData
+	if snapshot {
+		// Entities missing from a snapshot were removed while disconnected.
+		for _, old := range c.States.All() {
+			if _, ok := msg.Event.Added[old.EntityID]; !ok {
+				c.States.Delete(old.EntityID)
+				changes = append(changes, StateChangedData{EntityID: old.EntityID, OldState: old})
+			}
+		}
+	}
+	for entityID, compressed := range msg.Event.Added {
+		state := compressed.expand(entityID)
+		old, ok := c.States.Get(entityID)
+		c.States.Set(state)
+		if !ok || old.State != state.State || !old.LastUpdatedTime().Equal(state.LastUpdatedTime()) {
+			changes = append(changes, StateChangedData{EntityID: entityID, NewState: state, OldState: old})
+		}
+	}
+	for entityID, diff := range msg.Event.Changed {
+		old, ok := c.States.Get(entityID)
+		if !ok {
+			continue
+		}
+		state := diff.apply(old)
+		c.States.Set(state)
+		changes = append(changes, StateChangedData{EntityID: entityID, NewState: state, OldState: old})
+	}
+	for _, entityID := range msg.Event.Removed {
+		old, ok := c.States.Get(entityID)
+		if !ok {
+			continue
+		}
+		c.States.Delete(entityID)
+		changes = append(changes, StateChangedData{EntityID: entityID, OldState: old})
+	}
+
+	if initial {
+		c.mutex.Lock()
+		close(sub.ready)
+		c.mutex.Unlock()
+		return nil
+	}
+
+	events := make([]Event, 0, len(changes))
+	for _, change := range changes {
+		raw, err := json.Marshal(change)
+		if err != nil {
+			continue
+		}
+		fired := change.NewState.LastUpdated
+		if fired == "" {
+			fired = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		events = append(events, Event{EventType: "state_changed", Data: raw, Origin: "LOCAL", TimeFired: fired})
+	}
+	return events
+}
+
+// expand converts a compressed state to a full one.
+func (s compressedState) expand(entityID string) State {
+	state := State{
+		EntityID:    entityID,
+		State:       s.State,
+		Attributes:  s.Attributes,
+		LastChanged: formatTimestamp(s.LastChanged),
+		Context:     decodeContext(s.Context),
+	}
+	if state.Attributes == nil {
+		state.Attributes = make(map[string]interface{})
+	}
+	state.LastUpdated = state.LastChanged
+	if s.LastUpdated != 0 {
+		state.LastUpdated = formatTimestamp(s.LastUpdated)
+	}
+	return state
+}
+
+// apply returns the state with the diff applied. The old state is not modified.
+func (d compressedDiff) apply(old State) State {
+	state := old
+	state.Attributes = make(map[string]interface{}, len(old.Attributes)+len(d.Add.Attributes))
+	for k, v := range old.Attributes {
+		state.Attributes[k] = v
+	}
+	for k, v := range d.Add.Attributes {
+		state.Attributes[k] = v
+	}
+	for _, k := range d.Remove.Attributes {
+		delete(state.Attributes, k)
+	}
+
+	if d.Add.State != nil {
+		state.State = *d.Add.State
+	}
+	if len(d.Add.Context) > 0 {
+		state.Context = decodeContext(d.Add.Context)
+	}
+	if d.Add.LastChanged != nil {
+		state.LastChanged = formatTimestamp(*d.Add.LastChanged)
+		state.LastUpdated = state.LastChanged
+	}
+	if d.Add.LastUpdated != nil {
+		state.LastUpdated = formatTimestamp(*d.Add.LastUpdated)
+	}
+	return state
+}
+
+// decodeContext reads a context sent either as its ID or as an object.
+func decodeContext(raw json.RawMessage) Context {
+	var result Context
+	if len(raw) == 0 {
+		return result
+	}
+	if json.Unmarshal(raw, &result.ID) != nil {
+		json.Unmarshal(raw, &result)
+	}
+	return result
+}
+
+// formatTimestamp converts Unix seconds to the RFC 3339 form of full states.
+func formatTimestamp(seconds float64) string {
+	if seconds == 0 {
+		return ""
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(math.Round(frac*1e6))*1e3).UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,39 @@
+package hass
+
+// ResultError is the error payload of a failed Home Assistant result. It is
+// returned by Client.Do and can be matched against the errors below with
+// errors.Is, which compares error codes.
+type ResultError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error codes sent by Home Assistant, plus connection_lost reported by the
+// client itself for requests in flight when the connection drops.
+var (
+	ErrConnectionLost         = &ResultError{Code: "connection_lost", Message: "connection to Home Assistant lost"}
+	ErrHomeAssistant          = &ResultError{Code: "home_assistant_error", Message: "Home Assistant error"}
+	ErrInvalidFormat          = &ResultError{Code: "invalid_format", Message: "invalid request format"}
+	ErrNotAllowed             = &ResultError{Code: "not_allowed", Message: "not allowed"}
+	ErrNotFound               = &ResultError{Code: "not_found", Message: "not found"}
+	ErrServiceValidationError = &ResultError{Code: "service_validation_error", Message: "service validation failed"}
+	ErrTemplateError          = &ResultError{Code: "template_error", Message: "template error"}
+	ErrTimeout                = &ResultError{Code: "timeout", Message: "timed out"}
+	ErrUnauthorized           = &ResultError{Code: "unauthorized", Message: "unauthorized"}
+	ErrUnknownCommand         = &ResultError{Code: "unknown_command", Message: "unknown command"}
+	ErrUnknownError           = &ResultError{Code: "unknown_error", Message: "unknown error"}
+)
+
+// Error returns the message sent by Home Assistant.
+func (e *ResultError) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Message
+}
+
+// Is reports whether target is a ResultError with the same code.
+func (e *ResultError) Is(target error) bool {
+	t, ok := target.(*ResultError)
+	return ok && t.Code == e.Code
+}
@@ -0,0 +1,64 @@
+package hasstest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// camera is a camera snapshot served by camera_proxy.
+type camera struct {
+	contentType string
+	image       []byte
+}
+
+// SetCameraImage sets the snapshot served for a camera entity.
+func (s *Server) SetCameraImage(entityID, contentType string, image []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cameras[entityID] = camera{contentType: contentType, image: image}
+}
+
+// handleREST serves the REST API.
+func (s *Server) handleREST(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		restError(w, http.StatusUnauthorized, "401: Unauthorized")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/")
+	switch {
+	case strings.HasPrefix(path, "camera_proxy/") && r.Method == http.MethodGet:
+		s.mutex.Lock()
+		cam, ok := s.cameras[strings.TrimPrefix(path, "camera_proxy/")]
+		s.mutex.Unlock()
+		if !ok {
+			restError(w, http.StatusNotFound, "Entity not found")
+			return
+		}
+		w.Header().Set("Content-Type", cam.contentType)
+		w.Write(cam.image)
+	case path == "error_log" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(s.ErrorLog))
+	case path == "config/core/check_config" && r.Method == http.MethodPost:
+		if s.ConfigErrors != "" {
+			restJSON(w, map[string]interface{}{"result": "invalid", "errors": s.ConfigErrors, "warnings": nil})
+		} else {
+			restJSON(w, map[string]interface{}{"result": "valid", "errors": nil, "warnings": nil})
+		}
+	default:
+		restError(w, http.StatusNotFound, "404: Not Found")
+	}
+}
+
+func restJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func restError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
@@ -0,0 +1,757 @@
+// Package hasstest provides a fake Home Assistant server for tests.
+package hasstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"hasscord/hass"
+)
+
+// Token is the access token the server accepts.
+const Token = "test-token"
+
+// ServiceCall records a call_service request received by the server.
+type ServiceCall struct {
+	Domain  string
+	Service string
+	Target  hass.Target
+	Data    map[string]interface{}
+}
+
+// Server is a fake Home Assistant websocket and REST API. It supports the auth
+// handshake, get_states, subscribe_events, subscribe_entities,
+// subscribe_trigger, render_template, unsubscribe_events, call_service,
+// history_during_period, logbook/get_events and the area, device and entity
+// registry lists over the websocket, and camera snapshots, the error log and
+// the configuration check over REST.
+// Tests can inject events and fire triggers.
+type Server struct {
+	*httptest.Server
+
+	// ServiceHandler, when set, is called for every call_service request. A
+	// returned error is sent back as a failed result.
+	ServiceHandler func(call ServiceCall) error
+
+	// SubscribeHandler, when set, is called for every subscribe_events
+	// request. A returned error is sent back as a failed result.
+	SubscribeHandler func(eventType string) error
+
+	// AuthDelay holds back auth_required on new connections, simulating a
+	// slow Home Assistant start.
+	AuthDelay time.Duration
+
+	// TemplateHandler renders templates for render_template. A returned error
+	// fails the request with template_error. Templates fail while it is nil.
+	TemplateHandler func(template string) (interface{}, error)
+
+	// ErrorLog is served as the error log, and ConfigErrors fails the
+	// configuration check when set.
+	ErrorLog     string
+	ConfigErrors string
+
+	mutex    sync.Mutex
+	states   map[string]hass.State
+	history  map[string][]hass.State // every state set, oldest first
+	cameras  map[string]camera
+	areas    map[string]hass.Area
+	devices  map[string]hass.Device
+	entities map[string]hass.EntityEntry
+	calls    []ServiceCall
+	conns    map[*conn]bool
+	upgrader websocket.Upgrader
+}
+
+// conn is one client connection and its subscriptions.
+type conn struct {
+	ws            *websocket.Conn
+	writeMutex    sync.Mutex
+	mutex         sync.Mutex
+	subscriptions map[int]string // subscription ID to event type filter
+	entities      map[int]bool   // subscribe_entities subscription IDs
+	triggers      map[int]json.RawMessage
+	templates     map[int]string
+}
+
+// NewServer starts a fake Home Assistant server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		states:   make(map[string]hass.State),
+		history:  make(map[string][]hass.State),
+		cameras:  make(map[string]camera),
+		areas:    make(map[string]hass.Area),
+		devices:  make(map[string]hass.Device),
+		entities: make(map[string]hass.EntityEntry),
+		conns:    make(map[*conn]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL returns the websocket URL of the server.
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.Server.URL, "http") + "/api/websocket"
+}
+
+// Client connects and authenticates a hass.Client to the server.
+func (s *Server) Client() (*hass.Client, error) {
+	client, err := hass.New(s.URL(), Token)
+	if err != nil {
+		return nil, err
+	}
+	err = client.Authenticate()
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// AddState sets an entity's state without emitting an event.
+func (s *Server) AddState(state hass.State) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state = withTimestamps(state)
+	s.states[state.EntityID] = state
+	s.history[state.EntityID] = append(s.history[state.EntityID], state)
+}
+
+// SetState changes an entity's state and emits a state_changed event.
+func (s *Server) SetState(state hass.State) {
+	state = withTimestamps(state)
+
+	s.mutex.Lock()
+	old := s.states[state.EntityID]
+	s.states[state.EntityID] = state
+	s.history[state.EntityID] = append(s.history[state.EntityID], state)
+	s.mutex.Unlock()
+
+	s.SendEvent("state_changed", hass.StateChangedData{
+		EntityID: state.EntityID,
+		NewState: state,
+		OldState: old,
+	})
+	if old.EntityID == "" {
+		s.sendEntities(map[string]interface{}{"a": map[string]interface{}{state.EntityID: compress(state)}})
+	} else {
+		s.sendEntities(map[string]interface{}{"c": map[string]interface{}{state.EntityID: diff(old, state)}})
+	}
+}
+
+// RemoveState removes an entity and emits a state_changed event without a
+// new state.
+func (s *Server) RemoveState(entityID string) {
+	s.mutex.Lock()
+	old := s.states[entityID]
+	delete(s.states, entityID)
+	s.mutex.Unlock()
+
+	s.SendEvent("state_changed", hass.StateChangedData{EntityID: entityID, OldState: old})
+	s.sendEntities(map[string]interface{}{"r": []string{entityID}})
+}
+
+// SetArea adds or updates an area and emits area_registry_updated.
+func (s *Server) SetArea(area hass.Area) {
+	s.mutex.Lock()
+	s.areas[area.AreaID] = area
+	s.mutex.Unlock()
+	s.SendEvent("area_registry_updated", map[string]string{"action": "update", "area_id": area.AreaID})
+}
+
+// SetDevice adds or updates a device and emits device_registry_updated.
+func (s *Server) SetDevice(device hass.Device) {
+	s.mutex.Lock()
+	s.devices[device.ID] = device
+	s.mutex.Unlock()
+	s.SendEvent("device_registry_updated", map[string]string{"action": "update", "device_id": device.ID})
+}
+
+// SetEntity adds or updates an entity registry entry and emits
+// entity_registry_updated.
+func (s *Server) SetEntity(entity hass.EntityEntry) {
+	s.mutex.Lock()
+	s.entities[entity.EntityID] = entity
+	s.mutex.Unlock()
+	s.SendEvent("entity_registry_updated", map[string]string{"action": "update", "entity_id": entity.EntityID})
+}
+
+// SendEvent emits an event to every matching subscription.
+func (s *Server) SendEvent(eventType string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		panic(fmt.Sprintf("hasstest: marshaling event data: %v", err))
+	}
+	event := hass.Event{
+		EventType: eventType,
+		Data:      raw,
+		Origin:    "LOCAL",
+		TimeFired: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	for _, c := range s.connections() {
+		c.mutex.Lock()
+		ids := make([]int, 0, len(c.subscriptions))
+		for id, filter := range c.subscriptions {
+			if filter == "" || filter == eventType {
+				ids = append(ids, id)
+			}
+		}
+		c.mutex.Unlock()
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			c.write(map[string]interface{}{"id": id, "type": "event", "event": event})
+		}
+	}
+}
+
+// sendEntities sends a subscribe_entities message to every entity subscription.
+func (s *Server) sendEntities(event map[string]interface{}) {
+	for _, c := range s.connections() {
+		c.mutex.Lock()
+		ids := make([]int, 0, len(c.entities))
+		for id := range c.entities {
+			ids = append(ids, id)
+		}
+		c.mutex.Unlock()
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			c.write(map[string]interface{}{"id": id, "type": "event", "event": event})
+		}
+	}
+}
+
+// FireTrigger fires every subscribed trigger for which match returns true,
+// given the trigger definition as sent by the client.
+func (s *Server) FireTrigger(match func(trigger json.RawMessage) bool, data hass.TriggerData) {
+	event := map[string]interface{}{
+		"variables": map[string]interface{}{"trigger": data},
+		"context":   hass.Context{ID: "trigger"},
+	}
+	for _, c := range s.connections() {
+		c.mutex.Lock()
+		ids := make([]int, 0, len(c.triggers))
+		for id, trigger := range c.triggers {
+			if match(trigger) {
+				ids = append(ids, id)
+			}
+		}
+		c.mutex.Unlock()
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			c.write(map[string]interface{}{"id": id, "type": "event", "event": event})
+		}
+	}
+}
+
+// RenderTemplates renders every subscribed template again and sends the
+// results, as Home Assistant does when an entity a template uses changes.
+func (s *Server) RenderTemplates() {
+	for _, c := range s.connections() {
+		c.mutex.Lock()
+		ids := make([]int, 0, len(c.templates))
+		templates := make(map[int]string, len(c.templates))
+		for id, template := range c.templates {
+			ids = append(ids, id)
+			templates[id] = template
+		}
+		c.mutex.Unlock()
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			result, err := s.renderTemplate(templates[id])
+			event := map[string]interface{}{"result": result, "listeners": map[string]interface{}{}}
+			if err != nil {
+				event = map[string]interface{}{"error": err.Error(), "level": "ERROR"}
+			}
+			c.write(map[string]interface{}{"id": id, "type": "event", "event": event})
+		}
+	}
+}
+
+func (s *Server) renderTemplate(template string) (interface{}, error) {
+	s.mutex.Lock()
+	handler := s.TemplateHandler
+	s.mutex.Unlock()
+	if handler == nil {
+		return nil, fmt.Errorf("no template handler")
+	}
+	return handler(template)
+}
+
+// Calls returns the service calls received so far.
+func (s *Server) Calls() []ServiceCall {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]ServiceCall(nil), s.calls...)
+}
+
+// Subscriptions returns the number of active event subscriptions.
+func (s *Server) Subscriptions() int {
+	count := 0
+	for _, c := range s.connections() {
+		c.mutex.Lock()
+		count += len(c.subscriptions) + len(c.entities) + len(c.triggers) + len(c.templates)
+		c.mutex.Unlock()
+	}
+	return count
+}
+
+// DropConnections closes every client connection, simulating a restart of
+// Home Assistant. Clients are free to reconnect.
+func (s *Server) DropConnections() {
+	for _, c := range s.connections() {
+		c.ws.Close()
+	}
+}
+
+func (s *Server) connections() []*conn {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		s.handleREST(w, r)
+		return
+	}
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{ws: ws, subscriptions: make(map[int]string), entities: make(map[int]bool), triggers: make(map[int]json.RawMessage), templates: make(map[int]string)}
+	defer ws.Close()
+
+	if !s.authenticate(c) {
+		return
+	}
+
+	s.mutex.Lock()
+	s.conns[c] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, c)
+		s.mutex.Unlock()
+	}()
+
+	for {
+		var req map[string]json.RawMessage
+		err := ws.ReadJSON(&req)
+		if err != nil {
+			return
+		}
+		s.dispatch(c, req)
+	}
+}
+
+func (s *Server) authenticate(c *conn) bool {
+	s.mutex.Lock()
+	delay := s.AuthDelay
+	s.mutex.Unlock()
+	time.Sleep(delay)
+
+	c.write(map[string]string{"type": "auth_required", "ha_version": "2025.1.0"})
+
+	var auth struct {
+		Type        string `json:"type"`
+		AccessToken string `json:"access_token"`
+	}
+	err := c.ws.ReadJSON(&auth)
+	if err != nil {
+		return false
+	}
+	if auth.Type != "auth" || auth.AccessToken != Token {
+		c.write(map[string]string{"type": "auth_invalid", "message": "Invalid access token or password"})
+		return false
+	}
+	c.write(map[string]string{"type": "auth_ok", "ha_version": "2025.1.0"})
+	return true
+}
+
+func (s *Server) dispatch(c *conn, req map[string]json.RawMessage) {
+	var id int
+	var msgType string
+	json.Unmarshal(req["id"], &id)
+	json.Unmarshal(req["type"], &msgType)
+
+	switch msgType {
+	case "get_states":
+		s.mutex.Lock()
+		states := make([]hass.State, 0, len(s.states))
+		for _, state := range s.states {
+			states = append(states, state)
+		}
+		s.mutex.Unlock()
+		sort.Slice(states, func(i, j int) bool { return states[i].EntityID < states[j].EntityID })
+		c.result(id, states)
+
+	case "config/area_registry/list":
+		s.mutex.Lock()
+		c.result(id, sortedValues(s.areas))
+		s.mutex.Unlock()
+
+	case "config/device_registry/list":
+		s.mutex.Lock()
+		c.result(id, sortedValues(s.devices))
+		s.mutex.Unlock()
+
+	case "config/entity_registry/list":
+		s.mutex.Lock()
+		c.result(id, sortedValues(s.entities))
+		s.mutex.Unlock()
+
+	case "history/history_during_period":
+		start, end, entityIDs := periodQuery(req)
+		history := make(map[string][]map[string]interface{})
+		for _, entityID := range entityIDs {
+			for _, state := range s.statesBetween(entityID, start, end) {
+				history[entityID] = append(history[entityID], compressHistory(state))
+			}
+		}
+		c.result(id, history)
+
+	case "logbook/get_events":
+		start, end, entityIDs := periodQuery(req)
+		entries := []map[string]interface{}{}
+		for _, entry := range s.logbook("", start, end) {
+			if len(entityIDs) > 0 && !contains(entityIDs, entry.EntityID) {
+				continue
+			}
+			entries = append(entries, map[string]interface{}{
+				"when":            timestamp(entry.When),
+				"name":            entry.Name,
+				"message":         entry.Message,
+				"entity_id":       entry.EntityID,
+				"state":           entry.State,
+				"context_user_id": nilIfEmpty(entry.ContextUserID),
+			})
+		}
+		c.result(id, entries)
+
+	case "subscribe_events":
+		var eventType string
+		json.Unmarshal(req["event_type"], &eventType)
+
+		s.mutex.Lock()
+		handler := s.SubscribeHandler
+		s.mutex.Unlock()
+
+		if handler != nil {
+			if err := handler(eventType); err != nil {
+				c.error(id, "unauthorized", err.Error())
+				return
+			}
+		}
+		c.mutex.Lock()
+		c.subscriptions[id] = eventType
+		c.mutex.Unlock()
+		c.result(id, nil)
+
+	case "subscribe_entities":
+		s.mutex.Lock()
+		added := make(map[string]interface{}, len(s.states))
+		for entityID, state := range s.states {
+			added[entityID] = compress(state)
+		}
+		// Hold the lock until the snapshot is sent, so no change slips in between.
+		defer s.mutex.Unlock()
+
+		c.mutex.Lock()
+		c.entities[id] = true
+		c.mutex.Unlock()
+		c.result(id, nil)
+		c.write(map[string]interface{}{"id": id, "type": "event", "event": map[string]interface{}{"a": added}})
+
+	case "subscribe_trigger":
+		c.mutex.Lock()
+		c.triggers[id] = req["trigger"]
+		c.mutex.Unlock()
+		c.result(id, nil)
+
+	case "render_template":
+		var template string
+		json.Unmarshal(req["template"], &template)
+		result, err := s.renderTemplate(template)
+		if err != nil {
+			c.error(id, "template_error", err.Error())
+			return
+		}
+		c.mutex.Lock()
+		c.templates[id] = template
+		c.mutex.Unlock()
+		c.result(id, nil)
+		c.write(map[string]interface{}{"id": id, "type": "event", "event": map[string]interface{}{"result": result, "listeners": map[string]interface{}{}}})
+
+	case "unsubscribe_events":
+		var subscription int
+		json.Unmarshal(req["subscription"], &subscription)
+		c.mutex.Lock()
+		_, ok := c.subscriptions[subscription]
+		if !ok {
+			_, ok = c.entities[subscription]
+		}
+		if !ok {
+			_, ok = c.triggers[subscription]
+		}
+		if !ok {
+			_, ok = c.templates[subscription]
+		}
+		delete(c.subscriptions, subscription)
+		delete(c.entities, subscription)
+		delete(c.triggers, subscription)
+		delete(c.templates, subscription)
+		c.mutex.Unlock()
+		if !ok {
+			c.error(id, "not_found", "Subscription not found.")
+			return
+		}
+		c.result(id, nil)
+
+	case "call_service":
+		var call ServiceCall
+		json.Unmarshal(req["domain"], &call.Domain)
+		json.Unmarshal(req["service"], &call.Service)
+		json.Unmarshal(req["target"], &call.Target)
+		json.Unmarshal(req["service_data"], &call.Data)
+
+		s.mutex.Lock()
+		s.calls = append(s.calls, call)
+		handler := s.ServiceHandler
+		s.mutex.Unlock()
+
+		if handler != nil {
+			if err := handler(call); err != nil {
+				c.error(id, "home_assistant_error", err.Error())
+				return
+			}
+		}
+		c.result(id, map[string]interface{}{
+			"context":  hass.Context{ID: fmt.Sprintf("ctx-%d", id)},
+			"response": nil,
+		})
+
+	default:
+		c.error(id, "unknown_command", "Unknown command.")
+	}
+}
+
+func (c *conn) write(v interface{}) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.ws.WriteJSON(v)
+}
+
+func (c *conn) result(id int, result interface{}) {
+	c.write(map[string]interface{}{"id": id, "type": "result", "success": true, "result": result})
+}
+
+func (c *conn) error(id int, code, message string) {
+	c.write(map[string]interface{}{
+		"id":      id,
+		"type":    "result",
+		"success": false,
+		"error":   hass.ResultError{Code: code, Message: message},
+	})
+}
+
+// withTimestamps fills in missing last_changed and last_updated values.
+func withTimestamps(state hass.State) hass.State {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if state.LastChanged == "" {
+		state.LastChanged = now
+	}
+	if state.LastUpdated == "" {
+		state.LastUpdated = state.LastChanged
+	}
+	return state
+}
+
+// compress converts a state to the short form used by subscribe_entities.
+func compress(state hass.State) map[string]interface{} {
+	compressed := map[string]interface{}{
+		"s":  state.State,
+		"a":  state.Attributes,
+		"c":  state.Context.ID,
+		"lc": timestamp(state.LastChanged),
+	}
+	if state.LastUpdated != state.LastChanged {
+		compressed["lu"] = timestamp(state.LastUpdated)
+	}
+	if state.Attributes == nil {
+		compressed["a"] = map[string]interface{}{}
+	}
+	return compressed
+}
+
+// compressHistory converts a state to the short form used by
+// history_during_period, which leaves out last_changed when it equals
+// last_updated.
+func compressHistory(state hass.State) map[string]interface{} {
+	compressed := map[string]interface{}{
+		"s":  state.State,
+		"a":  state.Attributes,
+		"lu": timestamp(state.LastUpdated),
+	}
+	if state.LastUpdated != state.LastChanged {
+		compressed["lc"] = timestamp(state.LastChanged)
+	}
+	return compressed
+}
+
+// diff returns the subscribe_entities change from old to state.
+func diff(old, state hass.State) map[string]interface{} {
+	add := map[string]interface{}{"c": state.Context.ID}
+	if state.State != old.State {
+		add["s"] = state.State
+		add["lc"] = timestamp(state.LastChanged)
+	}
+	if state.LastUpdated != state.LastChanged || state.State == old.State {
+		add["lu"] = timestamp(state.LastUpdated)
+	}
+
+	attributes := make(map[string]interface{})
+	for k, v := range state.Attributes {
+		if fmt.Sprint(old.Attributes[k]) != fmt.Sprint(v) {
+			attributes[k] = v
+		}
+	}
+	if len(attributes) > 0 {
+		add["a"] = attributes
+	}
+	change := map[string]interface{}{"+": add}
+
+	var removed []string
+	for k := range old.Attributes {
+		if _, ok := state.Attributes[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	if len(removed) > 0 {
+		sort.Strings(removed)
+		change["-"] = map[string]interface{}{"a": removed}
+	}
+	return change
+}
+
+// timestamp converts an RFC 3339 time to Unix seconds.
+func timestamp(value string) float64 {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0
+	}
+	return float64(t.UnixMicro()) / 1e6
+}
+
+// statesBetween returns the history of an entity between start and end,
+// starting with the state it had at start.
+func (s *Server) statesBetween(entityID string, start, end time.Time) []hass.State {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var states []hass.State
+	for _, state := range s.history[entityID] {
+		changed := state.LastChangedTime()
+		if changed.After(end) {
+			break
+		}
+		if !changed.After(start) && len(states) > 0 {
+			states = states[:0]
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// logbook returns a logbook entry for each state change between start and
+// end, of one entity or all of them.
+func (s *Server) logbook(entityID string, start, end time.Time) []hass.LogbookEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := []hass.LogbookEntry{}
+	for _, states := range sortedValues(s.history) {
+		for i, state := range states {
+			changed := state.LastChangedTime()
+			if (entityID != "" && state.EntityID != entityID) || changed.Before(start) || changed.After(end) {
+				continue
+			}
+			if i > 0 && states[i-1].State == state.State {
+				continue
+			}
+			name, _ := state.Attributes["friendly_name"].(string)
+			if name == "" {
+				name = state.EntityID
+			}
+			entries = append(entries, hass.LogbookEntry{
+				When:          state.LastChanged,
+				Name:          name,
+				Message:       "changed to " + state.State,
+				EntityID:      state.EntityID,
+				State:         state.State,
+				Domain:        strings.SplitN(state.EntityID, ".", 2)[0],
+				ContextUserID: state.Context.UserID,
+			})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].WhenTime().Before(entries[j].WhenTime()) })
+	return entries
+}
+
+// sortedValues returns the map's values ordered by key.
+func sortedValues[T any](m map[string]T) []T {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]T, 0, len(m))
+	for _, key := range keys {
+		values = append(values, m[key])
+	}
+	return values
+}
+
+// periodQuery reads the period and entities of a history or logbook
+// request. The end defaults to now.
+func periodQuery(req map[string]json.RawMessage) (start, end time.Time, entityIDs []string) {
+	json.Unmarshal(req["start_time"], &start)
+	json.Unmarshal(req["end_time"], &end)
+	json.Unmarshal(req["entity_ids"], &entityIDs)
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return start, end, entityIDs
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// nilIfEmpty sends empty strings as null, as Home Assistant does for missing
+// context fields.
+func nilIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,111 @@
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LogbookEntry is one logbook entry. The context fields describe what caused
+// it, e.g. the user or automation that called a service.
+type LogbookEntry struct {
+	When              string `json:"when"`
+	Name              string `json:"name"`
+	Message           string `json:"message"`
+	EntityID          string `json:"entity_id"`
+	State             string `json:"state"`
+	Domain            string `json:"domain"`
+	ContextUserID     string `json:"context_user_id"`
+	ContextEventType  string `json:"context_event_type"`
+	ContextDomain     string `json:"context_domain"`
+	ContextService    string `json:"context_service"`
+	ContextEntityID   string `json:"context_entity_id"`
+	ContextName       string `json:"context_name"`
+	ContextMessage    string `json:"context_message"`
+	ContextEntityName string `json:"context_entity_id_name"`
+}
+
+// WhenTime parses When, returning the zero time if it is missing or invalid.
+func (e LogbookEntry) WhenTime() time.Time {
+	t, err := time.Parse(time.RFC3339Nano, e.When)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// History returns the states of each entity between start and end, oldest
+// first, keyed by entity ID. The first state of each entity is the one it had
+// at start. Entities without history are left out.
+func (c *Client) History(ctx context.Context, start, end time.Time, entityIDs ...string) (map[string][]State, error) {
+	result, err := c.Do(ctx, map[string]interface{}{
+		"type":                     "history/history_during_period",
+		"start_time":               start.UTC().Format(time.RFC3339Nano),
+		"end_time":                 end.UTC().Format(time.RFC3339Nano),
+		"entity_ids":               entityIDs,
+		"include_start_time_state": true,
+		"significant_changes_only": false,
+		"minimal_response":         false,
+		"no_attributes":            false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history: %w", err)
+	}
+
+	var periods map[string][]compressedState
+	err = json.Unmarshal(result.Result, &periods)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding history: %w", err)
+	}
+
+	history := make(map[string][]State, len(periods))
+	for entityID, compressed := range periods {
+		states := make([]State, 0, len(compressed))
+		for _, state := range compressed {
+			// Unlike subscribe_entities, history leaves out last_changed
+			// when it equals last_updated.
+			if state.LastChanged == 0 {
+				state.LastChanged = state.LastUpdated
+			}
+			states = append(states, state.expand(entityID))
+		}
+		history[entityID] = states
+	}
+	return history, nil
+}
+
+// Logbook returns the logbook entries between start and end, oldest first,
+// for the given entities or, if none are given, for all of them.
+func (c *Client) Logbook(ctx context.Context, start, end time.Time, entityIDs ...string) ([]LogbookEntry, error) {
+	req := map[string]interface{}{
+		"type":       "logbook/get_events",
+		"start_time": start.UTC().Format(time.RFC3339Nano),
+		"end_time":   end.UTC().Format(time.RFC3339Nano),
+	}
+	if len(entityIDs) > 0 {
+		req["entity_ids"] = entityIDs
+	}
+
+	result, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logbook: %w", err)
+	}
+
+	// The websocket API sends when as Unix seconds rather than RFC 3339.
+	var raw []struct {
+		LogbookEntry
+		When float64 `json:"when"`
+	}
+	err = json.Unmarshal(result.Result, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding logbook: %w", err)
+	}
+
+	entries := make([]LogbookEntry, 0, len(raw))
+	for _, entry := range raw {
+		entry.LogbookEntry.When = formatTimestamp(entry.When)
+		entries = append(entries, entry.LogbookEntry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,301 @@
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry list commands and the events Home Assistant fires when they change.
+const (
+	areaRegistryList   = "config/area_registry/list"
+	deviceRegistryList = "config/device_registry/list"
+	entityRegistryList = "config/entity_registry/list"
+
+	areaRegistryUpdated   = "area_registry_updated"
+	deviceRegistryUpdated = "device_registry_updated"
+	entityRegistryUpdated = "entity_registry_updated"
+)
+
+// registryLists maps registry update events to the list command to re-run.
+var registryLists = map[string]string{
+	areaRegistryUpdated:   areaRegistryList,
+	deviceRegistryUpdated: deviceRegistryList,
+	entityRegistryUpdated: entityRegistryList,
+}
+
+// Area is an entry of the area registry.
+type Area struct {
+	AreaID string `json:"area_id"`
+	Name   string `json:"name"`
+}
+
+// Device is an entry of the device registry.
+type Device struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	NameByUser   string `json:"name_by_user"`
+	AreaID       string `json:"area_id"`
+	Manufacturer string `json:"manufacturer"`
+	Model        string `json:"model"`
+}
+
+// DisplayName returns the name given by the user, or the integration's name.
+func (d Device) DisplayName() string {
+	if d.NameByUser != "" {
+		return d.NameByUser
+	}
+	return d.Name
+}
+
+// EntityEntry is an entry of the entity registry.
+type EntityEntry struct {
+	EntityID     string `json:"entity_id"`
+	Name         string `json:"name"`          // set by the user, empty if not renamed
+	OriginalName string `json:"original_name"` // provided by the integration
+	DeviceID     string `json:"device_id"`
+	AreaID       string `json:"area_id"` // overrides the device's area when set
+	Platform     string `json:"platform"`
+}
+
+// Registry caches Home Assistant's area, device and entity registries.
+type Registry struct {
+	mutex    sync.RWMutex
+	areas    map[string]Area
+	devices  map[string]Device
+	entities map[string]EntityEntry
+}
+
+// NewRegistry creates an empty registry cache.
+func NewRegistry() *Registry {
+	return &Registry{
+		areas:    make(map[string]Area),
+		devices:  make(map[string]Device),
+		entities: make(map[string]EntityEntry),
+	}
+}
+
+// SetAreas replaces the cached areas.
+func (r *Registry) SetAreas(areas []Area) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.areas = make(map[string]Area, len(areas))
+	for _, area := range areas {
+		r.areas[area.AreaID] = area
+	}
+}
+
+// SetDevices replaces the cached devices.
+func (r *Registry) SetDevices(devices []Device) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.devices = make(map[string]Device, len(devices))
+	for _, device := range devices {
+		r.devices[device.ID] = device
+	}
+}
+
+// SetEntities replaces the cached entity entries.
+func (r *Registry) SetEntities(entities []EntityEntry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entities = make(map[string]EntityEntry, len(entities))
+	for _, entity := range entities {
+		r.entities[entity.EntityID] = entity
+	}
+}
+
+// Areas returns every area ordered by name.
+func (r *Registry) Areas() []Area {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	areas := make([]Area, 0, len(r.areas))
+	for _, area := range r.areas {
+		areas = append(areas, area)
+	}
+	sort.Slice(areas, func(i, j int) bool { return strings.ToLower(areas[i].Name) < strings.ToLower(areas[j].Name) })
+	return areas
+}
+
+// Entity returns the registry entry of an entity.
+func (r *Registry) Entity(entityID string) (EntityEntry, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	entity, ok := r.entities[entityID]
+	return entity, ok
+}
+
+// DeviceOf returns the device an entity belongs to.
+func (r *Registry) DeviceOf(entityID string) (Device, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	entity, ok := r.entities[entityID]
+	if !ok || entity.DeviceID == "" {
+		return Device{}, false
+	}
+	device, ok := r.devices[entity.DeviceID]
+	return device, ok
+}
+
+// AreaOf returns the area of an entity, taken from the entity itself or
+// otherwise from its device.
+func (r *Registry) AreaOf(entityID string) (Area, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	entity, ok := r.entities[entityID]
+	if !ok {
+		return Area{}, false
+	}
+	areaID := entity.AreaID
+	if areaID == "" {
+		areaID = r.devices[entity.DeviceID].AreaID
+	}
+	area, ok := r.areas[areaID]
+	return area, ok
+}
+
+// AreaName returns the name of an entity's area, or "" if it has none.
+func (r *Registry) AreaName(entityID string) string {
+	area, _ := r.AreaOf(entityID)
+	return area.Name
+}
+
+// DeviceName returns the name of an entity's device, or "" if it has none.
+func (r *Registry) DeviceName(entityID string) string {
+	device, _ := r.DeviceOf(entityID)
+	return device.DisplayName()
+}
+
+// FriendlyName returns the name Home Assistant shows for an entity: its
+// friendly_name attribute, its registry name, or its object ID.
+func (c *Client) FriendlyName(entityID string) string {
+	if state, ok := c.States.Get(entityID); ok {
+		if name, ok := state.Attributes["friendly_name"].(string); ok && name != "" {
+			return name
+		}
+	}
+	if entity, ok := c.Registry.Entity(entityID); ok {
+		if entity.Name != "" {
+			return entity.Name
+		}
+		if entity.OriginalName != "" {
+			return entity.OriginalName
+		}
+	}
+	_, objectID, _ := strings.Cut(entityID, ".")
+	return objectID
+}
+
+// LoadRegistries fetches the area, device and entity registries into the
+// registry cache. The first call also subscribes to registry update events,
+// so the cache follows changes made in Home Assistant.
+func (c *Client) LoadRegistries(ctx context.Context) error {
+	c.mutex.Lock()
+	watching := c.watchingRegistries
+	c.mutex.Unlock()
+	if !watching {
+		err := c.watchRegistries(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, list := range []string{areaRegistryList, deviceRegistryList, entityRegistryList} {
+		err := c.loadRegistry(ctx, list)
+		if err != nil {
+			return err
+		}
+	}
+	c.mutex.Lock()
+	c.registriesLoaded = true
+	c.mutex.Unlock()
+
+	area, device, entity := c.Registry.counts()
+	log.Printf("Loaded %d area(s), %d device(s) and %d entity registry entries", area, device, entity)
+	return nil
+}
+
+// watchRegistries subscribes to each registry update event and reloads the
+// registry it names. The subscriptions last as long as the client.
+func (c *Client) watchRegistries(ctx context.Context) error {
+	var subs []*Subscription
+	for eventType := range registryLists {
+		sub, err := c.Subscribe(ctx, eventType)
+		if err != nil {
+			for _, sub := range subs {
+				sub.Unsubscribe(ctx)
+			}
+			return err
+		}
+		subs = append(subs, sub)
+		go func() {
+			for range sub.Events() {
+				c.refreshRegistry(eventType)
+			}
+		}()
+	}
+	c.mutex.Lock()
+	c.watchingRegistries = true
+	c.mutex.Unlock()
+	return nil
+}
+
+// loadRegistry runs one registry list command and stores the result.
+func (c *Client) loadRegistry(ctx context.Context, list string) error {
+	result, err := c.Do(ctx, map[string]interface{}{"type": list})
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", list, err)
+	}
+	return c.Registry.set(list, result.Result)
+}
+
+// refreshRegistry reloads the registry that changed according to an event.
+func (c *Client) refreshRegistry(eventType string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := c.loadRegistry(ctx, registryLists[eventType])
+	if err != nil {
+		log.Printf("Error refreshing registry after %s: %v", eventType, err)
+	}
+}
+
+// set decodes a registry list result into the matching cache.
+func (r *Registry) set(list string, result json.RawMessage) error {
+	var err error
+	switch list {
+	case areaRegistryList:
+		var areas []Area
+		if err = json.Unmarshal(result, &areas); err == nil {
+			r.SetAreas(areas)
+		}
+	case deviceRegistryList:
+		var devices []Device
+		if err = json.Unmarshal(result, &devices); err == nil {
+			r.SetDevices(devices)
+		}
+	case entityRegistryList:
+		var entities []EntityEntry
+		if err = json.Unmarshal(result, &entities); err == nil {
+			r.SetEntities(entities)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error decoding %s result: %w", list, err)
+	}
+	return nil
+}
+
+func (r *Registry) counts() (areas, devices, entities int) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.areas), len(r.devices), len(r.entities)
+}
@@ -0,0 +1,178 @@
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxErrorBody limits how much of an error response is read for its message.
+const maxErrorBody = 64 * 1024
+
+// RESTClient calls Home Assistant's REST API, for the things the websocket
+// API doesn't offer or that are simpler over HTTP, such as camera snapshots
+// and the error log. Failed requests return the same *ResultError values as
+// the websocket client, chosen by HTTP status.
+type RESTClient struct {
+	BaseURL    string // e.g. http://homeassistant.local:8123
+	Token      string
+	HTTPClient *http.Client
+}
+
+// ConfigCheck is the result of checking Home Assistant's configuration.
+type ConfigCheck struct {
+	Result   string `json:"result"` // "valid" or "invalid"
+	Errors   string `json:"errors"`
+	Warnings string `json:"warnings"`
+}
+
+// Valid reports whether the configuration has no errors.
+func (c ConfigCheck) Valid() bool {
+	return c.Result == "valid"
+}
+
+// NewRESTClient creates a REST client for the Home Assistant instance whose
+// websocket API is at websocketURL, e.g. ws://homeassistant.local:8123/api/websocket.
+func NewRESTClient(websocketURL, token string) (*RESTClient, error) {
+	u, err := url.Parse(websocketURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Home Assistant URL: %w", err)
+	}
+	switch u.Scheme {
+	case "ws", "http":
+		u.Scheme = "http"
+	case "wss", "https":
+		u.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("invalid Home Assistant URL %q: unsupported scheme %q", websocketURL, u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/api/websocket")
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	return &RESTClient{
+		BaseURL:    strings.TrimSuffix(u.String(), "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// do sends a request to path below /api and returns the response, which
+// the caller must close. Responses other than 2xx are returned as errors.
+func (c *RESTClient) do(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	endpoint := c.BaseURL + "/api/" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+	return resp, nil
+}
+
+// requestJSON sends a request and decodes its JSON response into v.
+func (c *RESTClient) requestJSON(ctx context.Context, method, path string, query url.Values, v interface{}) error {
+	resp, err := c.do(ctx, method, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// statusError converts a failed response to a *ResultError, keeping the
+// message Home Assistant sent.
+func statusError(resp *http.Response) error {
+	var code string
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		code = ErrInvalidFormat.Code
+	case http.StatusUnauthorized:
+		code = ErrUnauthorized.Code
+	case http.StatusForbidden:
+		code = ErrNotAllowed.Code
+	case http.StatusNotFound:
+		code = ErrNotFound.Code
+	case http.StatusGatewayTimeout:
+		code = ErrTimeout.Code
+	case http.StatusInternalServerError:
+		code = ErrHomeAssistant.Code
+	default:
+		code = ErrUnknownError.Code
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var payload struct {
+		Message string `json:"message"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &payload) == nil && payload.Message != "" {
+		message = payload.Message
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return &ResultError{Code: code, Message: message}
+}
+
+// CameraSnapshot returns the current image of a camera and its content type.
+func (c *RESTClient) CameraSnapshot(ctx context.Context, entityID string) ([]byte, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "camera_proxy/"+url.PathEscape(entityID), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get snapshot of %s: %w", entityID, err)
+	}
+	defer resp.Body.Close()
+
+	image, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get snapshot of %s: %w", entityID, err)
+	}
+	return image, resp.Header.Get("Content-Type"), nil
+}
+
+// ErrorLog returns Home Assistant's error log as text.
+func (c *RESTClient) ErrorLog(ctx context.Context) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "error_log", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get error log: %w", err)
+	}
+	defer resp.Body.Close()
+
+	text, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to get error log: %w", err)
+	}
+	return string(text), nil
+}
+
+// CheckConfig checks Home Assistant's configuration files. An invalid
+// configuration is not an error; see ConfigCheck.Valid.
+func (c *RESTClient) CheckConfig(ctx context.Context) (*ConfigCheck, error) {
+	var check ConfigCheck
+	err := c.requestJSON(ctx, http.MethodPost, "config/core/check_config", nil, &check)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check configuration: %w", err)
+	}
+	return &check, nil
+}
@@ -0,0 +1,159 @@
+package hass
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// eventBuffer is the number of events a subscription holds for its consumer.
+const eventBuffer = 256
+
+// Subscription is an active subscribe_events or subscribe_entities request.
+// Events are delivered on a buffered channel; when the consumer falls behind
+// and the buffer is full, the oldest event is dropped so the connection is
+// never held up, and Overflows is signalled.
+type Subscription struct {
+	client    *Client
+	req       map[string]interface{} // request without ID, re-sent after reconnects
+	eventType string
+	events    chan Event
+	dropped   atomic.Uint64
+	overflows chan struct{}
+
+	id     int // current request ID, renewed on every reconnect; guarded by client.mutex
+	closed bool
+
+	// decode turns a raw event message into events, for subscriptions whose
+	// messages are not plain events. It runs on the read loop.
+	decode func(data []byte) []Event
+
+	// Entity subscriptions only, guarded by client.mutex.
+	entities bool
+	snapshot bool          // the next message lists every entity
+	ready    chan struct{} // closed once the first snapshot is cached
+}
+
+// Subscribe subscribes to events of one type, or to every event if
+// eventType is empty. The subscription is re-issued after reconnects until
+// it is unsubscribed or the client is closed, which closes its channel.
+func (c *Client) Subscribe(ctx context.Context, eventType string) (*Subscription, error) {
+	req := map[string]interface{}{"type": "subscribe_events"}
+	if eventType != "" {
+		req["event_type"] = eventType
+	}
+
+	sub := &Subscription{client: c, req: req, eventType: eventType, events: make(chan Event, eventBuffer), overflows: make(chan struct{}, 1)}
+	err := c.subscribe(ctx, sub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s events: %w", sub.describe(), err)
+	}
+	return sub, nil
+}
+
+// subscribe registers a subscription and sends its request. It is registered
+// before sending, so events following the result are not missed.
+func (c *Client) subscribe(ctx context.Context, sub *Subscription) error {
+	c.mutex.Lock()
+	sub.id = c.MessageID
+	c.MessageID++
+	c.subscriptions[sub.id] = sub
+	c.mutex.Unlock()
+
+	_, err := c.send(ctx, sub.id, sub.req)
+	if err != nil {
+		c.mutex.Lock()
+		delete(c.subscriptions, sub.id)
+		c.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Events returns the channel events are delivered on.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Overflows receives a value after events were dropped, so consumers that
+// need every change can resynchronize, e.g. from the state cache. Drops that
+// happen before the value is received are reported by the same value.
+func (s *Subscription) Overflows() <-chan struct{} {
+	return s.overflows
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe ends the subscription and closes its channel. The channel is
+// closed even if Home Assistant could not be told, since the client stops
+// delivering events either way.
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	c := s.client
+	c.mutex.Lock()
+	if s.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	id := s.id
+	delete(c.subscriptions, id)
+	s.close()
+	c.mutex.Unlock()
+
+	_, err := c.Do(ctx, map[string]interface{}{"type": "unsubscribe_events", "subscription": id})
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe from %s events: %w", s.describe(), err)
+	}
+	return nil
+}
+
+// deliver passes an event to the consumer without blocking, dropping the
+// oldest buffered event if needed. It must be called with client.mutex held.
+func (s *Subscription) deliver(event Event) {
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- event:
+		return
+	default:
+	}
+
+	// Only the read loop sends, so after taking one event out there is room.
+	select {
+	case <-s.events:
+	default:
+	}
+	s.events <- event
+
+	select {
+	case s.overflows <- struct{}{}:
+	default:
+	}
+	dropped := s.dropped.Add(1)
+	if dropped == 1 || dropped%100 == 0 {
+		log.Printf("Dropped %d %s event(s): consumer is not keeping up", dropped, s.describe())
+	}
+}
+
+// close closes the event channel. It must be called with client.mutex held.
+func (s *Subscription) close() {
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+}
+
+// describe names the subscribed event type for logs and errors.
+func (s *Subscription) describe() string {
+	if s.entities {
+		return "entity"
+	}
+	if s.eventType == "" {
+		return "all"
+	}
+	return s.eventType
+}
@@ -0,0 +1,104 @@
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// templateEvent is the event type given to events of template subscriptions.
+const templateEvent = "template"
+
+// TemplateResult is one rendering of a template. Result holds the rendered
+// value as Home Assistant sent it, which is parsed into a number, list or
+// other JSON value when the output looks like one. Error is set instead when
+// rendering failed.
+type TemplateResult struct {
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+	Level  string          `json:"level"`
+}
+
+// Text returns the result as text: strings unquoted, other values as JSON.
+func (r TemplateResult) Text() string {
+	var text string
+	if json.Unmarshal(r.Result, &text) == nil {
+		return text
+	}
+	return string(r.Result)
+}
+
+// SubscribeTemplate renders a Jinja template in Home Assistant and renders
+// it again whenever the entities it uses change. Each rendering is delivered
+// as an event of type "template" whose data is a TemplateResult. Syntax
+// errors fail the subscription with ErrTemplateError; errors while rendering
+// are delivered as results.
+func (c *Client) SubscribeTemplate(ctx context.Context, template string) (*Subscription, error) {
+	sub := &Subscription{
+		client:    c,
+		req:       map[string]interface{}{"type": "render_template", "template": template, "report_errors": true},
+		eventType: templateEvent,
+		events:    make(chan Event, eventBuffer),
+		overflows: make(chan struct{}, 1),
+		decode:    decodeTemplate,
+	}
+	err := c.subscribe(ctx, sub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return sub, nil
+}
+
+// RenderTemplate renders a Jinja template once. Rendering errors are
+// returned as a *ResultError matching ErrTemplateError.
+func (c *Client) RenderTemplate(ctx context.Context, template string) (string, error) {
+	sub, err := c.SubscribeTemplate(ctx, template)
+	if err != nil {
+		return "", err
+	}
+	defer sub.Unsubscribe(context.Background())
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return "", fmt.Errorf("failed to render template: %w", ErrConnectionLost)
+			}
+			var result TemplateResult
+			err := json.Unmarshal(event.Data, &result)
+			if err != nil {
+				return "", fmt.Errorf("error decoding template result: %w", err)
+			}
+			if result.Error != "" && result.Level == "WARNING" {
+				// Warnings are followed by the result.
+				continue
+			}
+			if result.Error != "" {
+				return "", &ResultError{Code: ErrTemplateError.Code, Message: result.Error}
+			}
+			return result.Text(), nil
+		case <-ctx.Done():
+			return "", fmt.Errorf("failed to render template: %w", ctx.Err())
+		}
+	}
+}
+
+// decodeTemplate turns a render_template message into a template event.
+func decodeTemplate(data []byte) []Event {
+	var msg struct {
+		Event json.RawMessage `json:"event"`
+	}
+	err := json.Unmarshal(data, &msg)
+	if err != nil {
+		log.Printf("Error decoding template event: %v", err)
+		return nil
+	}
+	return []Event{{
+		EventType: templateEvent,
+		Data:      msg.Event,
+		Origin:    "LOCAL",
+		TimeFired: time.Now().UTC().Format(time.RFC3339Nano),
+	}}
+}
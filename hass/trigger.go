@@ -0,0 +1,66 @@
+package hass
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// triggerEvent is the event type given to events of trigger subscriptions.
+const triggerEvent = "trigger"
+
+// TriggerData describes why a trigger fired. Which fields are set depends on
+// the trigger platform: state and numeric_state triggers name the entity and
+// its states, time and template triggers only the platform and description.
+type TriggerData struct {
+	ID          string `json:"id"`
+	Idx         string `json:"idx"`
+	Platform    string `json:"platform"`
+	EntityID    string `json:"entity_id"`
+	FromState   *State `json:"from_state"`
+	ToState     *State `json:"to_state"`
+	Description string `json:"description"`
+}
+
+// SubscribeTrigger asks Home Assistant to evaluate triggers written as in
+// automations, e.g. a numeric_state trigger with "for". Each time one fires,
+// an event of type "trigger" whose data is a TriggerData is delivered.
+func (c *Client) SubscribeTrigger(ctx context.Context, trigger interface{}) (*Subscription, error) {
+	sub := &Subscription{
+		client:    c,
+		req:       map[string]interface{}{"type": "subscribe_trigger", "trigger": trigger},
+		eventType: triggerEvent,
+		events:    make(chan Event, eventBuffer),
+		overflows: make(chan struct{}, 1),
+		decode:    decodeTrigger,
+	}
+	err := c.subscribe(ctx, sub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to trigger: %w", err)
+	}
+	return sub, nil
+}
+
+// decodeTrigger turns a subscribe_trigger message into a trigger event.
+func decodeTrigger(data []byte) []Event {
+	var msg struct {
+		Event struct {
+			Variables struct {
+				Trigger json.RawMessage `json:"trigger"`
+			} `json:"variables"`
+		} `json:"event"`
+	}
+	err := json.Unmarshal(data, &msg)
+	if err != nil || len(msg.Event.Variables.Trigger) == 0 {
+		log.Printf("Error decoding trigger event: %v", err)
+		return nil
+	}
+	return []Event{{
+		EventType: triggerEvent,
+		Data:      msg.Event.Variables.Trigger,
+		Origin:    "LOCAL",
+		TimeFired: time.Now().UTC().Format(time.RFC3339Nano),
+	}}
+}
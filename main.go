@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"hasscord/bot"
@@ -37,13 +41,50 @@ func main() {
 		log.Printf("")
 	}
 
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	trackerRules, err := compileTrackerRules(cfg)
+	if err != nil {
+		log.Fatalf("Error in alert rules: %v", err)
+	}
+	log.Printf("Loaded configuration: %s", cfg)
 
 	b, err := bot.New(cfg)
 	if err != nil {
 		log.Fatalf("Error creating bot: %v", err)
 	}
 
+	// Each tracker alerts in its own channel with its own rules
+	var trackers []*sensors.Tracker
+	for _, trackerCfg := range cfg.TrackerConfigs() {
+		tracker := sensors.NewTracker(b.Session, trackerCfg.Name, trackerCfg.Channel, sensors.RealClock{})
+		tracker.SetRules(trackerRules[trackerCfg.Name])
+		trackers = append(trackers, tracker)
+	}
+
+	var reloader *config.Reloader
+	if cfg.Path != "" {
+		reloader = config.NewReloader(cfg.Path, func(newCfg *config.Config) error {
+			trackerRules, err := compileTrackerRules(newCfg)
+			if err != nil {
+				return err
+			}
+			for _, setting := range cfg.Update(newCfg) {
+				log.Printf("Changed %s only takes effect after a restart", setting)
+			}
+			for _, tracker := range trackers {
+				if rules, ok := trackerRules[tracker.Name()]; ok {
+					tracker.SetRules(rules)
+				}
+			}
+			return nil
+		})
+		go reloader.Watch(5 * time.Second)
+	}
+
 	// Start Home Assistant client
 	hassClient, err := hass.New(cfg.HassURL, cfg.HassToken)
 	if err != nil {
@@ -55,21 +96,93 @@ func main() {
 		log.Fatalf("Error authenticating with Home Assistant: %v", err)
 	}
 
+	// Camera snapshots are only available over the REST API
+	restClient, err := hass.NewRESTClient(cfg.HassURL, cfg.HassToken)
+	if err != nil {
+		log.Fatalf("Error creating Home Assistant REST client: %v", err)
+	}
+
 	// Register commands
 	b.RegisterCommand(&commands.Ping{})
 	b.RegisterCommand(&commands.ClearChannel{Config: cfg})
-	b.RegisterCommand(&commands.State{HassClient: hassClient})
-	b.RegisterCommand(&commands.Pause{})
+	stateCmd := &commands.State{HassClient: hassClient, Trackers: trackers, AreaOf: hassClient.Registry.AreaOf}
+	stateCmd.RegisterButtons(b)
+	b.RegisterCommand(stateCmd)
+	b.RegisterCommand(&commands.Pause{HassClient: hassClient, Trackers: trackers})
+	b.RegisterCommand(&commands.Call{HassClient: hassClient})
+	b.RegisterCommand(&commands.History{HassClient: hassClient})
+	b.RegisterCommand(&commands.Graph{HassClient: hassClient})
+	b.RegisterCommand(&commands.Snapshot{HassClient: hassClient, RESTClient: restClient})
+	templateCmd := &commands.Template{HassClient: hassClient}
+	templateCmd.RegisterButtons(b)
+	b.RegisterCommand(templateCmd)
+	b.RegisterCommand(&commands.Config{Config: cfg, Reloader: reloader, RESTClient: restClient})
 
 	go hassClient.Listen()
 
-	events, err := hassClient.SubscribeToEvents()
+	// Keep the state cache current; its first snapshot reconciles saved sensors
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	stateChanges, err := hassClient.SubscribeEntities(ctx)
+	if err != nil {
+		log.Fatalf("Error subscribing to Home Assistant entities: %v", err)
+	}
+	states := hassClient.States.All()
+
+	// Registries need an admin token; without them areas and devices are unknown
+	err = hassClient.LoadRegistries(ctx)
+	cancel()
 	if err != nil {
-		log.Fatalf("Error subscribing to Home Assistant events: %v", err)
+		log.Printf("Error loading Home Assistant registries, areas and devices will be unknown: %v", err)
 	}
+	for _, tracker := range trackers {
+		tracker.SetRegistry(hassClient.Registry)
 
-	go sensors.HandleHassEvents(b, events, cfg.ChannelID)
-	go sensors.CheckOnSensors(b, cfg.ChannelID, cfg.SensorOnTimeout, cfg.SensorOnTimeoutReminder)
+		if cfg.StateFile != "" {
+			tracker.SetStore(sensors.NewFileStore(stateFile(cfg.StateFile, tracker.Name())))
+			tracker.RestoreState(states)
+		}
+
+		// Track entities that are already alerting, now and after every reconnect
+		tracker.SyncStates(states)
+		hassClient.OnReconnect(tracker.SyncStates)
+
+		tracker.RegisterButtons(b, hassClient)
+
+		// Rules with triggers are evaluated by Home Assistant
+		err = tracker.SubscribeTriggers(hassClient)
+		if err != nil {
+			log.Printf("Error subscribing to rule triggers of tracker %s: %v", tracker.Name(), err)
+		}
+	}
+	go sensors.HandleEntities(stateChanges, hassClient.States, trackers...)
 
 	b.Start()
+
+	for _, tracker := range trackers {
+		tracker.SaveState()
+	}
+}
+
+// compileTrackerRules compiles the rules of every tracker, keyed by tracker name.
+func compileTrackerRules(cfg *config.Config) (map[string][]*sensors.Rule, error) {
+	trackerRules := make(map[string][]*sensors.Rule)
+	for _, trackerCfg := range cfg.TrackerConfigs() {
+		rules, err := sensors.CompileRules(trackerCfg.Rules, trackerCfg.Schedules)
+		if err != nil {
+			return nil, fmt.Errorf("tracker %s: %w", trackerCfg.Name, err)
+		}
+		trackerRules[trackerCfg.Name] = rules
+	}
+	return trackerRules, nil
+}
+
+// stateFile returns the state file of a tracker: the configured one for the
+// main tracker, and one named after the tracker next to it for the others,
+// e.g. state.windows.json.
+func stateFile(path, tracker string) string {
+	if tracker == config.MainTracker {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + tracker + ext
 }
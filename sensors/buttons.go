@@ -0,0 +1,149 @@
+package sensors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"hasscord/bot"
+	"hasscord/hass"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// alertComponent prefixes the component handler name used by alert buttons.
+// Each tracker registers its own handler, named after the tracker.
+const alertComponent = "alert"
+
+// closeServices maps domains that can close an opening to the service doing it.
+var closeServices = map[string]string{
+	"cover": "close_cover",
+	"lock":  "lock",
+}
+
+// RegisterButtons routes alert button presses to the tracker. The client is
+// used to find and close a matching cover or lock; it may be nil.
+func (t *Tracker) RegisterButtons(b *bot.Bot, client *hass.Client) {
+	t.mutex.Lock()
+	t.hassClient = client
+	t.mutex.Unlock()
+
+	b.RegisterComponentHandler(t.componentName(), bot.CapabilityPause, t.handleAlertButton)
+}
+
+// componentName returns the component handler name of the tracker's buttons.
+func (t *Tracker) componentName() string {
+	return alertComponent + "-" + t.name
+}
+
+// sendAlertLocked sends an alert message with acknowledge, snooze and close
+// buttons. Alerts of entities whose IDs don't fit in a button's custom ID are
+// sent without buttons. The caller must hold t.mutex.
+func (t *Tracker) sendAlertLocked(entityID, message string) {
+	buttons := []discordgo.MessageComponent{
+		discordgo.Button{Label: "Acknowledge", Style: discordgo.SuccessButton, CustomID: bot.ComponentID(t.componentName(), "ack", entityID)},
+		discordgo.Button{Label: "Snooze 15m", Style: discordgo.SecondaryButton, CustomID: bot.ComponentID(t.componentName(), "snooze", "15m", entityID)},
+		discordgo.Button{Label: "Snooze 1h", Style: discordgo.SecondaryButton, CustomID: bot.ComponentID(t.componentName(), "snooze", "1h", entityID)},
+	}
+	if closer := closerFor(t.hassClient, entityID); closer != "" {
+		buttons = append(buttons, discordgo.Button{Label: "Close via HA", Style: discordgo.DangerButton, CustomID: bot.ComponentID(t.componentName(), "close", entityID)})
+	}
+
+	msg := &discordgo.MessageSend{
+		Content:    message,
+		Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}},
+	}
+	for _, button := range buttons {
+		if len(button.(discordgo.Button).CustomID) > bot.MaxCustomID {
+			log.Printf("Sending alert for %s without buttons: its entity ID is too long", entityID)
+			msg.Components = nil
+			break
+		}
+	}
+
+	_, err := t.messager.ChannelMessageSendComplex(t.channelID, msg)
+	if err != nil {
+		log.Printf("Error sending alert for %s: %v", entityID, err)
+	}
+}
+
+// closerFor returns a cover or lock entity sharing the sensor's object ID,
+// e.g. cover.dvere_garaz for binary_sensor.dvere_garaz, or "" if none exists.
+func closerFor(client *hass.Client, entityID string) string {
+	if client == nil {
+		return ""
+	}
+
+	_, objectID, _ := strings.Cut(entityID, ".")
+	for _, domain := range []string{"cover", "lock"} {
+		candidate := domain + "." + objectID
+		if _, ok := client.States.Get(candidate); ok {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// handleAlertButton applies an alert button press to the tracked entity.
+func (t *Tracker) handleAlertButton(user *discordgo.User, args []string) string {
+	if len(args) < 2 {
+		return "❌ Unknown action."
+	}
+
+	who := "someone"
+	if user != nil {
+		who = user.Username
+	}
+
+	switch args[0] {
+	case "ack":
+		entityID := args[1]
+		if !t.updateSensor(entityID, func(state *SensorState) { state.AckedBy = who }) {
+			return fmt.Sprintf("ℹ️ `%s` is no longer tracked.", entityID)
+		}
+		log.Printf("%s acknowledged %s", who, entityID)
+		return fmt.Sprintf("✅ Acknowledged by **%s**, no more reminders.", who)
+
+	case "snooze":
+		if len(args) < 3 {
+			return "❌ Unknown action."
+		}
+		duration, err := time.ParseDuration(args[1])
+		if err != nil {
+			return "❌ Invalid snooze duration."
+		}
+		entityID := args[2]
+		until := t.clock.Now().Add(duration)
+		if !t.updateSensor(entityID, func(state *SensorState) { state.SnoozedUntil = until }) {
+			return fmt.Sprintf("ℹ️ `%s` is no longer tracked.", entityID)
+		}
+		log.Printf("%s snoozed %s until %s", who, entityID, until.Format(time.RFC3339))
+		return fmt.Sprintf("💤 Snoozed by **%s** until %s.", who, until.Format("15:04"))
+
+	case "close":
+		entityID := args[1]
+		t.mutex.Lock()
+		client := t.hassClient
+		t.mutex.Unlock()
+		closer := closerFor(client, entityID)
+		if closer == "" {
+			return fmt.Sprintf("❌ No cover or lock found for `%s`.", entityID)
+		}
+
+		domain, _, _ := strings.Cut(closer, ".")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := client.CallService(ctx, domain, closeServices[domain], &hass.Target{EntityID: []string{closer}}, nil)
+		if err != nil {
+			log.Printf("Error closing %s: %v", closer, err)
+			return fmt.Sprintf("❌ Failed to close `%s`: %v", closer, err)
+		}
+		log.Printf("%s closed %s via %s", who, entityID, closer)
+		return fmt.Sprintf("🔒 **%s** asked Home Assistant to close `%s`.", who, closer)
+	}
+
+	return "❌ Unknown action."
+}
@@ -0,0 +1,29 @@
+package sensors
+
+import "time"
+
+// Clock abstracts time for the tracker, so that timeouts can be driven
+// deterministically in tests.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine after the duration elapses.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a scheduled call that can be cancelled.
+type Timer interface {
+	Stop() bool
+}
+
+// RealClock is the Clock backed by the time package.
+type RealClock struct{}
+
+// Now returns the current time.
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc schedules f with time.AfterFunc.
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
@@ -0,0 +1,163 @@
+package sensors
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pause silences notifications for every entity matching Pattern, including
+// entities that start alerting after the pause was created.
+type Pause struct {
+	Pattern string    `json:"pattern"`      // glob matched against the entity ID or its object ID
+	Until   time.Time `json:"until"`        // zero means until resumed
+	By      string    `json:"by,omitempty"` // who created the pause
+	Created time.Time `json:"created"`
+}
+
+// Matches reports whether the pause applies to the entity.
+func (p Pause) Matches(entityID string) bool {
+	if ok, _ := path.Match(p.Pattern, entityID); ok {
+		return true
+	}
+	_, objectID, _ := strings.Cut(entityID, ".")
+	ok, _ := path.Match(p.Pattern, objectID)
+	return ok
+}
+
+// String describes the pause for chat messages.
+func (p Pause) String() string {
+	if p.Until.IsZero() {
+		return fmt.Sprintf("`%s` until resumed", p.Pattern)
+	}
+	return fmt.Sprintf("`%s` until %s", p.Pattern, p.Until.Format("Jan 2 15:04"))
+}
+
+// ValidatePattern checks that a pause pattern is a valid glob.
+func ValidatePattern(pattern string) error {
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return fmt.Errorf("invalid pattern `%s`: %w", pattern, err)
+	}
+	return nil
+}
+
+// AddPause pauses notifications for entities matching the pattern until the
+// given time, or until resumed when until is zero. An existing pause for the
+// same pattern is replaced.
+func (t *Tracker) AddPause(pattern string, until time.Time, by string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.removePauseLocked(pattern)
+	p := Pause{Pattern: pattern, Until: until, By: by, Created: t.clock.Now()}
+	t.pauses = append(t.pauses, p)
+	t.armPauseLocked(p)
+	log.Printf("%s paused notifications for %s", by, p)
+	t.evaluateAllLocked()
+	t.saveLocked()
+}
+
+// RemovePause removes the pause for the pattern, reporting whether one existed.
+func (t *Tracker) RemovePause(pattern string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	removed := t.removePauseLocked(pattern)
+	if removed {
+		log.Printf("Removed pause for %s", pattern)
+		t.evaluateAllLocked()
+		t.saveLocked()
+	}
+	return removed
+}
+
+// ClearPauses removes every pattern pause and returns how many were active.
+func (t *Tracker) ClearPauses() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	count := len(t.pauses)
+	for _, p := range t.pauses {
+		t.removePauseLocked(p.Pattern)
+	}
+	t.evaluateAllLocked()
+	t.saveLocked()
+	return count
+}
+
+// Pauses returns the active pattern pauses ordered by creation time.
+func (t *Tracker) Pauses() []Pause {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	active := append([]Pause(nil), t.pauses...)
+	sort.Slice(active, func(i, j int) bool { return active[i].Created.Before(active[j].Created) })
+	return active
+}
+
+// removePauseLocked removes the pause for the pattern and cancels its expiry
+// timer. The caller must hold t.mutex.
+func (t *Tracker) removePauseLocked(pattern string) bool {
+	if timer, ok := t.pauseTimers[pattern]; ok {
+		timer.Stop()
+		delete(t.pauseTimers, pattern)
+	}
+	for i, p := range t.pauses {
+		if p.Pattern == pattern {
+			t.pauses = append(t.pauses[:i:i], t.pauses[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// armPauseLocked schedules the end of a timed pause. The caller must hold
+// t.mutex.
+func (t *Tracker) armPauseLocked(p Pause) {
+	if p.Until.IsZero() {
+		return
+	}
+	delay := p.Until.Sub(t.clock.Now())
+	if delay < 0 {
+		delay = 0
+	}
+	t.pauseTimers[p.Pattern] = t.clock.AfterFunc(delay, func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		t.expirePausesLocked()
+		t.evaluateAllLocked()
+		t.saveLocked()
+	})
+}
+
+// pausedLocked reports whether a pattern pause applies to the entity. The
+// caller must hold t.mutex.
+func (t *Tracker) pausedLocked(entityID string, now time.Time) bool {
+	for _, p := range t.pauses {
+		if (p.Until.IsZero() || now.Before(p.Until)) && p.Matches(entityID) {
+			return true
+		}
+	}
+	return false
+}
+
+// expirePausesLocked removes pauses that have ended and announces them. The
+// caller must hold t.mutex.
+func (t *Tracker) expirePausesLocked() {
+	now := t.clock.Now()
+	var active []Pause
+	for _, p := range t.pauses {
+		if p.Until.IsZero() || now.Before(p.Until) {
+			active = append(active, p)
+			continue
+		}
+		delete(t.pauseTimers, p.Pattern)
+		log.Printf("Pause for %s expired", p.Pattern)
+		t.messager.ChannelMessageSend(t.channelID, fmt.Sprintf("▶️ **Pause ended** for `%s`, notifications are active again.", p.Pattern))
+	}
+	t.pauses = active
+}
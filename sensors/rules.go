@@ -0,0 +1,386 @@
+package sensors
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"hasscord/config"
+	"hasscord/hass"
+)
+
+// Default timings and messages for rules that don't set their own.
+const (
+	defaultAlertState  = "on"
+	defaultTimeout     = 15 * time.Second
+	defaultReminder    = 60 * time.Second
+	defaultMaxReminder = 1 * time.Hour
+
+	defaultInitialMessage  = "`{{.Entity}}` has been `{{.State}}` for more than {{.Timeout}} seconds! @everyone"
+	defaultReminderMessage = "Reminder: `{{.Entity}}` is still `{{.State}}` (for {{.Duration}})! @everyone"
+	defaultGiveUpMessage   = "`{{.Entity}}` has been `{{.State}}` for over {{.MaxReminder}}. Stopping reminders."
+	defaultResolvedMessage = "`{{.Entity}}` is now `{{.State}}`."
+
+	// Trigger rules alert as soon as Home Assistant fires, so the default
+	// initial message doesn't mention the timeout.
+	defaultTriggerMessage = "`{{.Entity}}` is `{{.State}}`! @everyone"
+
+	// Threshold rules describe the threshold and announce the recovery.
+	defaultThresholdMessage = "`{{.Entity}}` has been {{.Threshold}} for more than {{.Timeout}} seconds (now `{{.State}}`)! @everyone"
+	defaultRecoveredMessage = "`{{.Entity}}` is back to normal (`{{.State}}`)."
+)
+
+// Rule is a compiled config.Rule used to match entities and render alerts.
+type Rule struct {
+	Name        string
+	AlertState  string
+	Timeout     time.Duration
+	Reminder    time.Duration
+	MaxReminder time.Duration
+	Schedule    config.Schedule // nil means the rule always alerts
+
+	// Above and Below make the rule alert on numeric states beyond them
+	// instead of on AlertState. Alerts resolve once the value is back past
+	// the threshold by Hysteresis.
+	Above      *float64
+	Below      *float64
+	Hysteresis float64
+
+	// Trigger and ResolveTrigger are Home Assistant trigger definitions for
+	// rules evaluated by Home Assistant rather than by state.
+	Trigger        []map[string]interface{}
+	ResolveTrigger []map[string]interface{}
+
+	entities      []string
+	regexes       []*regexp.Regexp
+	domains       []string
+	areas         []string
+	deviceClasses []string
+	exclude       []string
+
+	initial  *template.Template
+	reminder *template.Template
+	giveUp   *template.Template
+	resolved *template.Template
+}
+
+// MessageData is passed to rule message templates.
+type MessageData struct {
+	EntityID    string // full entity ID, e.g. "binary_sensor.dvere_garaz"
+	Entity      string // entity ID without its domain, e.g. "dvere_garaz"
+	Name        string // friendly name, falls back to Entity
+	Area        string // Home Assistant area name, empty if unknown
+	Device      string // Home Assistant device name, empty if unknown
+	State       string // current state value
+	Threshold   string // threshold of numeric rules, e.g. "above -15"
+	Timeout     int    // initial timeout in seconds
+	Duration    string // how long the entity has been in the alerting state
+	MaxReminder string // how long reminders are sent for
+}
+
+// CompileRules compiles rules that passed config.Validate.
+func CompileRules(rules []config.Rule, schedules map[string]config.Schedule) ([]*Rule, error) {
+	compiled := make([]*Rule, 0, len(rules))
+	for _, r := range rules {
+		rule, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		if r.Schedule != "" {
+			rule.Schedule = schedules[r.Schedule]
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled, nil
+}
+
+func compileRule(r config.Rule) (*Rule, error) {
+	rule := &Rule{
+		Name:          r.Name,
+		AlertState:    r.AlertState,
+		Timeout:       seconds(r.Timeout, defaultTimeout),
+		Reminder:      seconds(r.Reminder, defaultReminder),
+		MaxReminder:   seconds(r.MaxReminder, defaultMaxReminder),
+		entities:      r.Entities,
+		domains:       r.Domains,
+		areas:         r.Areas,
+		deviceClasses: r.DeviceClasses,
+		exclude:       r.Exclude,
+		Above:         r.Above,
+		Below:         r.Below,
+		Hysteresis:    r.Hysteresis,
+
+		Trigger:        r.Trigger,
+		ResolveTrigger: r.ResolveTrigger,
+	}
+	if rule.AlertState == "" {
+		rule.AlertState = defaultAlertState
+	}
+
+	initialMessage, resolvedMessage := defaultInitialMessage, defaultResolvedMessage
+	if rule.Triggered() {
+		// Home Assistant already waited for the trigger's "for".
+		rule.Timeout = 0
+		initialMessage = defaultTriggerMessage
+	}
+	if rule.Thresholded() {
+		initialMessage, resolvedMessage = defaultThresholdMessage, defaultRecoveredMessage
+	}
+
+	for _, expr := range r.Regexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", expr, err)
+		}
+		rule.regexes = append(rule.regexes, re)
+	}
+
+	var err error
+	if rule.initial, err = parseMessage("initial", r.Messages.Initial, initialMessage); err != nil {
+		return nil, err
+	}
+	if rule.reminder, err = parseMessage("reminder", r.Messages.Reminder, defaultReminderMessage); err != nil {
+		return nil, err
+	}
+	if rule.giveUp, err = parseMessage("give_up", r.Messages.GiveUp, defaultGiveUpMessage); err != nil {
+		return nil, err
+	}
+	if rule.resolved, err = parseMessage("resolved", r.Messages.Resolved, resolvedMessage); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func parseMessage(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s message: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+func seconds(value int, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return time.Duration(value) * time.Second
+}
+
+// Matches reports whether the entity is watched by this rule. Area is the
+// entity's Home Assistant area, or zero when it is not known. Rule areas match
+// its ID or its name, e.g. "living_room" matches "Living Room". Trigger rules
+// don't watch states and never match.
+func (r *Rule) Matches(state hass.State, area hass.Area) bool {
+	if r.Triggered() {
+		return false
+	}
+	entityID := state.EntityID
+
+	for _, pattern := range r.exclude {
+		if ok, _ := path.Match(pattern, entityID); ok {
+			return false
+		}
+	}
+
+	if len(r.entities) > 0 && !matchAny(r.entities, func(pattern string) bool {
+		ok, _ := path.Match(pattern, entityID)
+		return ok
+	}) {
+		return false
+	}
+
+	if len(r.regexes) > 0 {
+		matched := false
+		for _, re := range r.regexes {
+			if re.MatchString(entityID) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	domain, _, _ := strings.Cut(entityID, ".")
+	if len(r.domains) > 0 && !matchAny(r.domains, func(d string) bool { return d == domain }) {
+		return false
+	}
+
+	if len(r.areas) > 0 && !matchAny(r.areas, func(a string) bool { return MatchesArea(a, area) }) {
+		return false
+	}
+
+	if len(r.deviceClasses) > 0 {
+		deviceClass, _ := state.Attributes["device_class"].(string)
+		if !matchAny(r.deviceClasses, func(dc string) bool { return dc == deviceClass }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Active reports whether the rule's schedule allows alerts at t.
+func (r *Rule) Active(t time.Time) bool {
+	return r.Schedule == nil || r.Schedule.Active(t)
+}
+
+// IsAlerting reports whether the state value is the rule's alerting state,
+// or beyond its threshold. Entities of trigger rules stay alerting whatever
+// their state, until the rule's resolve trigger fires.
+func (r *Rule) IsAlerting(state string) bool {
+	if r.Thresholded() {
+		return r.beyond(state, 0)
+	}
+	return r.Triggered() || state == r.AlertState
+}
+
+// StaysAlerting reports whether an entity already tracked still is at the
+// state value. Once the initial alert was sent, threshold rules only resolve
+// when the value is back past the threshold by the hysteresis, so values
+// hovering around it don't flap; before that, the value must stay beyond the
+// threshold itself for the timeout. States that aren't numbers, such as
+// "unavailable", don't resolve threshold rules.
+func (r *Rule) StaysAlerting(state string, alerted bool) bool {
+	if !r.Thresholded() {
+		return r.IsAlerting(state)
+	}
+	if _, err := strconv.ParseFloat(state, 64); err != nil {
+		return true
+	}
+	if !alerted {
+		return r.beyond(state, 0)
+	}
+	return r.beyond(state, r.Hysteresis)
+}
+
+// Thresholded reports whether the rule alerts on numeric states beyond Above or Below.
+func (r *Rule) Thresholded() bool {
+	return r.Above != nil || r.Below != nil
+}
+
+// Threshold describes the rule's threshold, e.g. "above -15", or returns ""
+// if it has none.
+func (r *Rule) Threshold() string {
+	switch {
+	case r.Above != nil && r.Below != nil:
+		return fmt.Sprintf("below %g or above %g", *r.Below, *r.Above)
+	case r.Above != nil:
+		return fmt.Sprintf("above %g", *r.Above)
+	case r.Below != nil:
+		return fmt.Sprintf("below %g", *r.Below)
+	}
+	return ""
+}
+
+// alertCondition describes when the rule alerts, for logs.
+func (r *Rule) alertCondition() string {
+	if r.Thresholded() {
+		return r.Threshold()
+	}
+	return r.AlertState
+}
+
+// beyond reports whether the state is a number above Above or below Below,
+// with both thresholds moved back towards normal by margin.
+func (r *Rule) beyond(state string, margin float64) bool {
+	value, err := strconv.ParseFloat(state, 64)
+	if err != nil || math.IsNaN(value) {
+		return false
+	}
+	return r.Above != nil && value > *r.Above-margin || r.Below != nil && value < *r.Below+margin
+}
+
+// Triggered reports whether Home Assistant triggers decide when the rule alerts.
+func (r *Rule) Triggered() bool {
+	return len(r.Trigger) > 0
+}
+
+// MatchesArea reports whether name refers to the area, by its ID or by its
+// name, so "Living Room" and "living_room" both match the living room.
+func MatchesArea(name string, area hass.Area) bool {
+	if area.AreaID != "" && name == area.AreaID {
+		return true
+	}
+	return area.Name != "" && normalizeArea(name) == normalizeArea(area.Name)
+}
+
+// normalizeArea makes area names and IDs comparable.
+func normalizeArea(area string) string {
+	return strings.ReplaceAll(strings.ToLower(area), " ", "_")
+}
+
+func matchAny(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchRule returns the first rule watching the entity, or nil.
+func MatchRule(rules []*Rule, state hass.State, area hass.Area) *Rule {
+	for _, rule := range rules {
+		if rule.Matches(state, area) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// render executes a message template, falling back to a plain description on error.
+func (r *Rule) render(tmpl *template.Template, data MessageData) string {
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, data)
+	if err != nil {
+		return fmt.Sprintf("`%s` is `%s` (template error: %v)", data.Entity, data.State, err)
+	}
+	return sb.String()
+}
+
+// newMessageData builds template data for an entity tracked by this rule.
+func (r *Rule) newMessageData(entityID, name, state string, durationOn time.Duration) MessageData {
+	entity := entityID
+	if _, after, ok := strings.Cut(entityID, "."); ok {
+		entity = after
+	}
+	if name == "" {
+		name = entity
+	}
+	return MessageData{
+		EntityID:    entityID,
+		Entity:      entity,
+		Name:        name,
+		State:       state,
+		Threshold:   r.Threshold(),
+		Timeout:     int(r.Timeout / time.Second),
+		Duration:    durationOn.Round(time.Second).String(),
+		MaxReminder: formatDuration(r.MaxReminder),
+	}
+}
+
+// formatDuration renders a duration without zero components, e.g. "1h" or "1h30m".
+func formatDuration(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "an hour"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		s := d.String()
+		return strings.TrimSuffix(s, "0s")
+	default:
+		return d.String()
+	}
+}
@@ -0,0 +1,232 @@
+package sensors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"hasscord/hass"
+)
+
+// SavedSensor is the persisted form of a tracked sensor.
+type SavedSensor struct {
+	EntityID     string    `json:"entity_id"`
+	Rule         string    `json:"rule"`
+	Name         string    `json:"name,omitempty"`
+	State        string    `json:"state"`
+	OnTime       time.Time `json:"on_time"`
+	LastSent     time.Time `json:"last_sent"`
+	Paused       bool      `json:"paused,omitempty"`
+	AckedBy      string    `json:"acked_by,omitempty"`
+	SnoozedUntil time.Time `json:"snoozed_until"`
+}
+
+// Snapshot is everything the tracker persists between restarts.
+type Snapshot struct {
+	Sensors []SavedSensor `json:"sensors"`
+	Pauses  []Pause       `json:"pauses"`
+}
+
+// Store persists tracked sensors between restarts.
+type Store interface {
+	Load() (Snapshot, error)
+	Save(snapshot Snapshot) error
+}
+
+// SetStore enables persistence of tracked sensors.
+func (t *Tracker) SetStore(s Store) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.store = s
+}
+
+// FileStore keeps tracked sensors in a JSON file.
+type FileStore struct {
+	Path string
+
+	mutex sync.Mutex
+	last  []byte
+}
+
+// NewFileStore creates a store backed by the file at path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load reads the saved snapshot. A missing file yields an empty snapshot, and a
+// file in the older format of a bare list of sensors is read as their snapshot.
+func (f *FileStore) Load() (Snapshot, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var snapshot Snapshot
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, err
+	}
+
+	// Files written before pauses were persisted hold just the sensors.
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &snapshot.Sensors)
+	} else {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	if err != nil {
+		return snapshot, err
+	}
+	f.last = data
+	return snapshot, nil
+}
+
+// Save writes the snapshot atomically, skipping the write when nothing changed.
+func (f *FileStore) Save(snapshot Snapshot) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, f.last) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), ".hasscord-state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), f.Path); err != nil {
+		return err
+	}
+
+	f.last = data
+	return nil
+}
+
+// SaveState persists the currently tracked sensors, if a store is configured.
+func (t *Tracker) SaveState() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.saveLocked()
+}
+
+// saveLocked persists the tracked sensors. The caller must hold t.mutex.
+func (t *Tracker) saveLocked() {
+	if t.store == nil {
+		return
+	}
+
+	saved := make([]SavedSensor, 0, len(t.sensors))
+	for entityID, state := range t.sensors {
+		saved = append(saved, SavedSensor{
+			EntityID:     entityID,
+			Rule:         state.Rule.Name,
+			Name:         state.Name,
+			State:        state.State,
+			OnTime:       state.OnTime,
+			LastSent:     state.LastSent,
+			Paused:       state.Paused,
+			AckedBy:      state.AckedBy,
+			SnoozedUntil: state.SnoozedUntil,
+		})
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].EntityID < saved[j].EntityID })
+
+	err := t.store.Save(Snapshot{Sensors: saved, Pauses: t.pauses})
+	if err != nil {
+		log.Printf("Error saving sensor state: %v", err)
+	}
+}
+
+// RestoreState loads the saved sensors and reconciles them against the current
+// Home Assistant states. Sensors that stopped alerting while the bot was down
+// are dropped, with a resolved message if an alert had already been sent.
+func (t *Tracker) RestoreState(states []hass.State) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.store == nil {
+		return
+	}
+
+	snapshot, err := t.store.Load()
+	if err != nil {
+		log.Printf("Error loading sensor state: %v", err)
+		return
+	}
+	t.pauses = snapshot.Pauses
+	for _, p := range t.pauses {
+		t.armPauseLocked(p)
+	}
+
+	current := make(map[string]hass.State, len(states))
+	for _, state := range states {
+		current[state.EntityID] = state
+	}
+
+	restored := 0
+	for _, saved := range snapshot.Sensors {
+		rule := ruleByName(t.rules, saved.Rule)
+		if rule == nil {
+			log.Printf("Dropping saved sensor %s: rule %s no longer exists", saved.EntityID, saved.Rule)
+			continue
+		}
+
+		// Trigger rules aren't resolved by state, and may not be about an entity.
+		state, ok := current[saved.EntityID]
+		if rule.Triggered() {
+			state, ok = hass.State{EntityID: saved.EntityID, State: saved.State}, true
+		}
+		if !ok || !rule.StaysAlerting(state.State, !saved.LastSent.IsZero()) {
+			if !saved.LastSent.IsZero() {
+				data := t.messageDataLocked(rule, saved.EntityID, saved.Name, state.State, t.clock.Now().Sub(saved.OnTime))
+				t.messager.ChannelMessageSend(t.channelID, rule.render(rule.resolved, data))
+			}
+			log.Printf("Dropping saved sensor %s: no longer %s", saved.EntityID, rule.alertCondition())
+			continue
+		}
+
+		t.sensors[saved.EntityID] = SensorState{
+			OnTime:       saved.OnTime,
+			LastSent:     saved.LastSent,
+			Paused:       saved.Paused,
+			AckedBy:      saved.AckedBy,
+			SnoozedUntil: saved.SnoozedUntil,
+			Rule:         rule,
+			Name:         saved.Name,
+			State:        state.State,
+		}
+		restored++
+	}
+	t.evaluateAllLocked()
+
+	log.Printf("Restored %d tracked sensor(s) and %d pause(s) from saved state", restored, len(t.pauses))
+	t.saveLocked()
+}
+
+func ruleByName(rules []*Rule, name string) *Rule {
+	for _, rule := range rules {
+		if rule.Name == name {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,484 @@
+package sensors
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"hasscord/bot"
+	"hasscord/hass"
+)
+
+// Tracker follows entities while they are in their rule's alerting state and
+// sends the initial alert, reminders, give-up and resolved messages. Every
+// tracked entity has its own timer armed for the next moment something can
+// happen to it, so alerts fire on time without polling.
+type Tracker struct {
+	messager  bot.Messager
+	name      string // distinguishes the buttons of trackers sharing a channel
+	channelID string
+	clock     Clock
+
+	mutex       sync.Mutex
+	rules       []*Rule
+	sensors     map[string]SensorState
+	timers      map[string]Timer
+	pauses      []Pause
+	pauseTimers map[string]Timer
+	store       Store
+	hassClient  *hass.Client   // used to close entities from the "Close via HA" button
+	registry    *hass.Registry // areas and devices for rule matching and messages, may be nil
+
+	triggerMutex  sync.Mutex   // serializes trigger resubscriptions
+	triggerClient *hass.Client // subscribes to the triggers of trigger rules, nil until SubscribeTriggers
+	triggerSubs   []*hass.Subscription
+}
+
+// SensorState holds information about a sensor that is currently in its
+// rule's alerting state.
+type SensorState struct {
+	OnTime       time.Time
+	LastSent     time.Time
+	Paused       bool
+	AckedBy      string
+	SnoozedUntil time.Time
+	Rule         *Rule
+	Name         string
+	State        string
+}
+
+// NewTracker creates a tracker sending messages to the channel. The name
+// identifies the tracker's alert buttons, so it must be unique and stay the
+// same across restarts for buttons of earlier alerts to keep working.
+func NewTracker(s bot.Messager, name, channelID string, clock Clock) *Tracker {
+	return &Tracker{
+		messager:    s,
+		name:        name,
+		channelID:   channelID,
+		clock:       clock,
+		sensors:     make(map[string]SensorState),
+		timers:      make(map[string]Timer),
+		pauseTimers: make(map[string]Timer),
+	}
+}
+
+// SetRules replaces the rules used to pick watched entities. Tracked sensors
+// move to the new rule with the same name, or keep their old rule until they
+// resolve if it was removed.
+func (t *Tracker) SetRules(rules []*Rule) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.rules = rules
+	for entityID, state := range t.sensors {
+		if rule := ruleByName(rules, state.Rule.Name); rule != nil {
+			state.Rule = rule
+			t.sensors[entityID] = state
+		}
+	}
+	t.evaluateAllLocked()
+
+	if t.triggerClient != nil {
+		go func() {
+			if err := t.syncTriggers(); err != nil {
+				log.Printf("Error subscribing to rule triggers: %v", err)
+			}
+		}()
+	}
+}
+
+// SetRegistry sets the Home Assistant registry used to match rules by area
+// and to fill in the area and device of alert messages.
+func (t *Tracker) SetRegistry(registry *hass.Registry) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.registry = registry
+}
+
+// Name returns the tracker's name.
+func (t *Tracker) Name() string {
+	return t.name
+}
+
+// Rules returns the current rules.
+func (t *Tracker) Rules() []*Rule {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.rules
+}
+
+// Now returns the current time of the tracker's clock.
+func (t *Tracker) Now() time.Time {
+	return t.clock.Now()
+}
+
+// Sensors returns a copy of the tracked sensors keyed by entity ID.
+func (t *Tracker) Sensors() map[string]SensorState {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	sensors := make(map[string]SensorState, len(t.sensors))
+	for entityID, state := range t.sensors {
+		sensors[entityID] = state
+	}
+	return sensors
+}
+
+// HandleEvents processes Home Assistant events until the channel is closed.
+func (t *Tracker) HandleEvents(events <-chan hass.Event) {
+	for event := range events {
+		t.handleEvent(event)
+	}
+}
+
+// HandleEntities applies the state changes of an entities subscription to
+// the trackers until it ends. When changes were dropped because the trackers
+// fell behind, they are resynced from the state cache.
+func HandleEntities(sub *hass.Subscription, states *hass.StateCache, trackers ...*Tracker) {
+	events := sub.Events()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			for _, t := range trackers {
+				t.handleEvent(event)
+			}
+		case <-sub.Overflows():
+			log.Printf("Missed state changes, resyncing from the state cache")
+			current := states.All()
+			for _, t := range trackers {
+				t.SyncStates(current)
+			}
+		}
+	}
+}
+
+// handleEvent applies a state_changed event and ignores other events.
+func (t *Tracker) handleEvent(event hass.Event) {
+	if event.EventType != "state_changed" {
+		return
+	}
+
+	var stateData hass.StateChangedData
+	err := json.Unmarshal(event.Data, &stateData)
+	if err != nil {
+		log.Printf("Error unmarshaling state change data: %v", err)
+		return
+	}
+
+	t.HandleStateChange(stateData.EntityID, stateData.NewState)
+}
+
+// HandleStateChange updates tracking for an entity's new state.
+func (t *Tracker) HandleStateChange(entityID string, newState hass.State) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if state, exists := t.sensors[entityID]; exists {
+		if !state.Rule.StaysAlerting(newState.State, !state.LastSent.IsZero()) {
+			t.resolveLocked(entityID, state, newState.State)
+			log.Printf("Sensor %s changed state to %s", entityID, newState.State)
+		} else if state.Rule.Thresholded() && state.State != newState.State {
+			// Reminders of threshold rules show the latest value.
+			state.State = newState.State
+			t.sensors[entityID] = state
+		}
+		return
+	}
+
+	// We only care about entities watched by a rule
+	rule := MatchRule(t.rules, newState, t.areaLocked(entityID))
+	if rule != nil && rule.IsAlerting(newState.State) {
+		onTime := t.clock.Now()
+		t.trackLocked(entityID, rule, newState, onTime)
+		log.Printf("Sensor %s turned %s at %s (rule %s)", entityID, newState.State, onTime.Format(time.RFC3339), rule.Name)
+	}
+}
+
+// SyncStates reconciles the tracked sensors with a full snapshot of Home
+// Assistant states. Entities already in their alerting state are tracked from
+// their last_changed time, and tracked entities that are no longer alerting
+// are resolved. It is used on startup and after every reconnect, when
+// state_changed events may have been missed.
+func (t *Tracker) SyncStates(states []hass.State) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	current := make(map[string]hass.State, len(states))
+	seeded := 0
+	for _, state := range states {
+		current[state.EntityID] = state
+
+		if _, exists := t.sensors[state.EntityID]; exists {
+			continue
+		}
+
+		rule := MatchRule(t.rules, state, t.areaLocked(state.EntityID))
+		if rule == nil || !rule.IsAlerting(state.State) {
+			continue
+		}
+
+		onTime := state.LastChangedTime()
+		if onTime.IsZero() {
+			onTime = t.clock.Now()
+		}
+		t.trackLocked(state.EntityID, rule, state, onTime)
+		seeded++
+		log.Printf("Sensor %s is %s since %s (rule %s)", state.EntityID, state.State, onTime.Format(time.RFC3339), rule.Name)
+	}
+
+	for entityID, tracked := range t.sensors {
+		state, ok := current[entityID]
+		if tracked.Rule.Triggered() || ok && tracked.Rule.StaysAlerting(state.State, !tracked.LastSent.IsZero()) {
+			continue
+		}
+		t.resolveLocked(entityID, tracked, state.State)
+		log.Printf("Sensor %s is no longer %s", entityID, tracked.Rule.alertCondition())
+	}
+
+	log.Printf("Synced states: %d sensor(s) newly tracked, %d tracked in total", seeded, len(t.sensors))
+}
+
+// trackLocked starts tracking an entity. The caller must hold t.mutex.
+func (t *Tracker) trackLocked(entityID string, rule *Rule, state hass.State, onTime time.Time) {
+	name, _ := state.Attributes["friendly_name"].(string)
+	t.sensors[entityID] = SensorState{OnTime: onTime, Rule: rule, Name: name, State: state.State}
+	t.evaluateLocked(entityID)
+	t.saveLocked()
+}
+
+// resolveLocked stops tracking an entity that left its alerting state,
+// announcing it if an alert was sent. The caller must hold t.mutex.
+func (t *Tracker) resolveLocked(entityID string, state SensorState, newState string) {
+	if !state.LastSent.IsZero() {
+		data := t.messageDataLocked(state.Rule, entityID, state.Name, newState, t.clock.Now().Sub(state.OnTime))
+		t.messager.ChannelMessageSend(t.channelID, state.Rule.render(state.Rule.resolved, data))
+	}
+	t.removeLocked(entityID)
+}
+
+// removeLocked forgets an entity and cancels its timer. The caller must hold t.mutex.
+func (t *Tracker) removeLocked(entityID string) {
+	delete(t.sensors, entityID)
+	if timer, ok := t.timers[entityID]; ok {
+		timer.Stop()
+		delete(t.timers, entityID)
+	}
+	t.saveLocked()
+}
+
+// areaLocked returns the entity's area, or zero if unknown. The caller must
+// hold t.mutex.
+func (t *Tracker) areaLocked(entityID string) hass.Area {
+	if t.registry == nil {
+		return hass.Area{}
+	}
+	area, _ := t.registry.AreaOf(entityID)
+	return area
+}
+
+// messageDataLocked builds template data for a tracked entity, including its
+// area and device. The caller must hold t.mutex.
+func (t *Tracker) messageDataLocked(rule *Rule, entityID, name, state string, durationOn time.Duration) MessageData {
+	data := rule.newMessageData(entityID, name, state, durationOn)
+	if t.registry != nil {
+		data.Area = t.registry.AreaName(entityID)
+		data.Device = t.registry.DeviceName(entityID)
+	}
+	return data
+}
+
+// silencedLocked reports whether notifications for the sensor are currently
+// suppressed. The caller must hold t.mutex.
+func (t *Tracker) silencedLocked(entityID string, s SensorState, now time.Time) bool {
+	return s.Paused || s.AckedBy != "" || now.Before(s.SnoozedUntil) || !s.Rule.Active(now) || t.pausedLocked(entityID, now)
+}
+
+// evaluateAllLocked re-evaluates every tracked sensor, e.g. after pauses or
+// rules changed. The caller must hold t.mutex.
+func (t *Tracker) evaluateAllLocked() {
+	for entityID := range t.sensors {
+		t.evaluateLocked(entityID)
+	}
+}
+
+// evaluateLocked sends whatever message is due for the sensor and arms its
+// timer for the next one. The caller must hold t.mutex.
+func (t *Tracker) evaluateLocked(entityID string) {
+	state, ok := t.sensors[entityID]
+	if !ok {
+		return
+	}
+
+	now := t.clock.Now()
+	rule := state.Rule
+	durationOn := now.Sub(state.OnTime)
+
+	isInitialNotification := state.LastSent.IsZero()
+	shouldSendInitial := isInitialNotification && durationOn >= rule.Timeout
+
+	hasBeenNotified := !state.LastSent.IsZero()
+	isUnderMax := durationOn < rule.MaxReminder
+	timeForReminder := now.Sub(state.LastSent) >= rule.Reminder
+	shouldSendReminder := hasBeenNotified && isUnderMax && timeForReminder
+
+	isOverMax := durationOn >= rule.MaxReminder
+
+	silenced := t.silencedLocked(entityID, state, now)
+	data := t.messageDataLocked(rule, entityID, state.Name, state.State, durationOn)
+
+	// Check for initial timeout
+	if shouldSendInitial && !silenced {
+		t.sendAlertLocked(entityID, rule.render(rule.initial, data))
+		state.LastSent = now
+		t.sensors[entityID] = state
+		log.Printf("Sent initial message for %s", entityID)
+	} else if shouldSendReminder && !silenced {
+		// Resend message every reminder interval, up to the max duration
+		t.sendAlertLocked(entityID, rule.render(rule.reminder, data))
+		state.LastSent = now
+		t.sensors[entityID] = state
+		log.Printf("Sent reminder message for %s", entityID)
+	} else if isOverMax {
+		// Remove after the max duration (always remove, regardless of pause state)
+		if !silenced {
+			t.messager.ChannelMessageSend(t.channelID, rule.render(rule.giveUp, data))
+		}
+		t.removeLocked(entityID)
+		log.Printf("Removed %s from tracking after %s", entityID, rule.MaxReminder)
+		return
+	}
+
+	t.scheduleLocked(entityID, state, now, silenced)
+}
+
+// scheduleLocked arms the sensor's timer for the next time it needs to be
+// evaluated. The caller must hold t.mutex.
+func (t *Tracker) scheduleLocked(entityID string, state SensorState, now time.Time, silenced bool) {
+	rule := state.Rule
+
+	// Tracking always ends after the max reminder duration.
+	next := state.OnTime.Add(rule.MaxReminder)
+
+	if !silenced {
+		due := state.OnTime.Add(rule.Timeout)
+		if !state.LastSent.IsZero() {
+			due = state.LastSent.Add(rule.Reminder)
+		}
+		next = earliest(next, due)
+	} else {
+		// Wake up when the silence may end. Pattern pauses re-evaluate every
+		// sensor themselves when they expire.
+		if state.SnoozedUntil.After(now) {
+			next = earliest(next, state.SnoozedUntil)
+		}
+		if !rule.Active(now) {
+			next = earliest(next, now.Truncate(time.Minute).Add(time.Minute))
+		}
+	}
+
+	if timer, ok := t.timers[entityID]; ok {
+		timer.Stop()
+	}
+	delay := next.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	t.timers[entityID] = t.clock.AfterFunc(delay, func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		t.evaluateLocked(entityID)
+		t.saveLocked()
+	})
+}
+
+// updateSensor modifies a tracked sensor and re-evaluates it, reporting
+// whether it was tracked.
+func (t *Tracker) updateSensor(entityID string, update func(state *SensorState)) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state, ok := t.sensors[entityID]
+	if !ok {
+		return false
+	}
+	update(&state)
+	t.sensors[entityID] = state
+	t.evaluateLocked(entityID)
+	t.saveLocked()
+	return true
+}
+
+// PauseNotifications pauses notifications for currently open doors
+func (t *Tracker) PauseNotifications() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	count := 0
+	for entityID, state := range t.sensors {
+		if !state.Paused {
+			state.Paused = true
+			t.sensors[entityID] = state
+			count++
+		}
+	}
+	t.evaluateAllLocked()
+	t.saveLocked()
+
+	if count > 0 {
+		log.Printf("Paused notifications for %d currently open doors", count)
+	} else {
+		log.Printf("No open doors to pause notifications for")
+	}
+}
+
+// ResumeNotifications resumes notifications for currently open doors
+func (t *Tracker) ResumeNotifications() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	count := 0
+	for entityID, state := range t.sensors {
+		if state.Paused {
+			state.Paused = false
+			t.sensors[entityID] = state
+			count++
+		}
+	}
+	t.evaluateAllLocked()
+	t.saveLocked()
+
+	if count > 0 {
+		log.Printf("Resumed notifications for %d currently open doors", count)
+	} else {
+		log.Printf("No paused doors to resume notifications for")
+	}
+}
+
+// GetPauseStatus returns information about currently paused doors
+func (t *Tracker) GetPauseStatus() (int, int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.clock.Now()
+	total := len(t.sensors)
+	paused := 0
+
+	for entityID, state := range t.sensors {
+		if state.Paused || t.pausedLocked(entityID, now) {
+			paused++
+		}
+	}
+
+	return total, paused
+}
+
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
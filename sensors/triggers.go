@@ -0,0 +1,145 @@
+package sensors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"hasscord/hass"
+)
+
+// triggeredState is the state shown for trigger alerts not about an entity.
+const triggeredState = "triggered"
+
+// SubscribeTriggers subscribes to the Home Assistant triggers of every
+// trigger rule, and again whenever the rules change. Rules whose triggers
+// Home Assistant rejects are reported and skipped.
+func (t *Tracker) SubscribeTriggers(client *hass.Client) error {
+	t.mutex.Lock()
+	t.triggerClient = client
+	t.mutex.Unlock()
+
+	return t.syncTriggers()
+}
+
+// syncTriggers replaces the trigger subscriptions with those of the current
+// rules.
+func (t *Tracker) syncTriggers() error {
+	t.triggerMutex.Lock()
+	defer t.triggerMutex.Unlock()
+
+	t.mutex.Lock()
+	client, rules := t.triggerClient, t.rules
+	t.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, sub := range t.triggerSubs {
+		if err := sub.Unsubscribe(ctx); err != nil {
+			log.Printf("Error unsubscribing from rule trigger: %v", err)
+		}
+	}
+	t.triggerSubs = nil
+
+	var errs []error
+	for _, rule := range rules {
+		if !rule.Triggered() {
+			continue
+		}
+		sub, err := client.SubscribeTrigger(ctx, rule.Trigger)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", rule.Name, err))
+			continue
+		}
+		t.triggerSubs = append(t.triggerSubs, sub)
+		go t.handleTriggers(sub, rule, t.HandleTrigger)
+
+		if len(rule.ResolveTrigger) == 0 {
+			continue
+		}
+		sub, err = client.SubscribeTrigger(ctx, rule.ResolveTrigger)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %s resolve_trigger: %w", rule.Name, err))
+			continue
+		}
+		t.triggerSubs = append(t.triggerSubs, sub)
+		go t.handleTriggers(sub, rule, t.HandleResolveTrigger)
+	}
+	return errors.Join(errs...)
+}
+
+// handleTriggers passes the trigger events of a subscription to handle until
+// it is unsubscribed.
+func (t *Tracker) handleTriggers(sub *hass.Subscription, rule *Rule, handle func(rule *Rule, trigger hass.TriggerData)) {
+	for event := range sub.Events() {
+		var trigger hass.TriggerData
+		err := json.Unmarshal(event.Data, &trigger)
+		if err != nil {
+			log.Printf("Error unmarshaling trigger data: %v", err)
+			continue
+		}
+		handle(rule, trigger)
+	}
+}
+
+// HandleTrigger starts alerting for a trigger rule that fired. The alert is
+// about the entity that fired the trigger, or about the rule itself for
+// triggers without one, such as time triggers. Rules without a resolve
+// trigger only send the initial message.
+func (t *Tracker) HandleTrigger(rule *Rule, trigger hass.TriggerData) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key, state := triggerState(rule, trigger)
+	now := t.clock.Now()
+
+	if len(rule.ResolveTrigger) == 0 {
+		if !rule.Active(now) || t.pausedLocked(key, now) {
+			log.Printf("Rule %s triggered for %s while silenced", rule.Name, key)
+			return
+		}
+		name, _ := state.Attributes["friendly_name"].(string)
+		data := t.messageDataLocked(rule, key, name, state.State, 0)
+		t.messager.ChannelMessageSend(t.channelID, rule.render(rule.initial, data))
+		log.Printf("Sent trigger message for %s (rule %s)", key, rule.Name)
+		return
+	}
+
+	if _, exists := t.sensors[key]; exists {
+		return
+	}
+	t.trackLocked(key, rule, state, now)
+	log.Printf("Rule %s triggered for %s at %s", rule.Name, key, now.Format(time.RFC3339))
+}
+
+// HandleResolveTrigger resolves the alert a trigger rule started, when the
+// rule's resolve trigger fires for the same entity.
+func (t *Tracker) HandleResolveTrigger(rule *Rule, trigger hass.TriggerData) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key, state := triggerState(rule, trigger)
+	tracked, exists := t.sensors[key]
+	if !exists || tracked.Rule.Name != rule.Name {
+		return
+	}
+	t.resolveLocked(key, tracked, state.State)
+	log.Printf("Rule %s resolved for %s", rule.Name, key)
+}
+
+// triggerState returns the key an alert of a trigger rule is tracked under
+// and the state to report: the triggering entity and its new state, or the
+// rule name for triggers not about an entity.
+func triggerState(rule *Rule, trigger hass.TriggerData) (string, hass.State) {
+	if trigger.EntityID == "" {
+		return rule.Name, hass.State{EntityID: rule.Name, State: triggeredState}
+	}
+	if trigger.ToState != nil {
+		return trigger.EntityID, *trigger.ToState
+	}
+	return trigger.EntityID, hass.State{EntityID: trigger.EntityID, State: triggeredState}
+}
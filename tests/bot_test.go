@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/bwmarrin/discordgo"
@@ -12,13 +14,54 @@ import (
 type MockSession struct {
 	ChannelID string
 	Message   string
+	Sent      []*discordgo.MessageSend // every message sent, in order
+	Edits     []*discordgo.MessageEdit // every message edit, in order
+
+	mutex sync.Mutex
 }
 
 // ChannelMessageSend is a mock implementation of the ChannelMessageSend method.
 func (s *MockSession) ChannelMessageSend(channelID, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Content: content})
+}
+
+// ChannelMessageSendComplex is a mock implementation of the ChannelMessageSendComplex method.
+func (s *MockSession) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.ChannelID = channelID
-	s.Message = content
-	return nil, nil
+	s.Message = data.Content
+	s.Sent = append(s.Sent, data)
+	return &discordgo.Message{ID: fmt.Sprint(len(s.Sent)), ChannelID: channelID, Content: data.Content}, nil
+}
+
+// ChannelMessageEditComplex is a mock implementation of the ChannelMessageEditComplex method.
+func (s *MockSession) ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Edits = append(s.Edits, m)
+	return &discordgo.Message{ID: m.ID, ChannelID: m.Channel}, nil
+}
+
+// LastEdit returns the latest message edit, or nil if there was none.
+func (s *MockSession) LastEdit() *discordgo.MessageEdit {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.Edits) == 0 {
+		return nil
+	}
+	return s.Edits[len(s.Edits)-1]
+}
+
+// Messages returns the content of every message sent so far.
+func (s *MockSession) Messages() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	messages := make([]string, len(s.Sent))
+	for i, m := range s.Sent {
+		messages[i] = m.Content
+	}
+	return messages
 }
 
 func (s *MockSession) ChannelVoiceJoin(guildID, channelID string, mute, deaf bool) (voice *discordgo.VoiceConnection, err error) {
@@ -45,6 +88,26 @@ func (p *PingCommand) Name() string {
 	return "ping"
 }
 
+// Description returns the command's description.
+func (p *PingCommand) Description() string {
+	return "Check that the bot is alive"
+}
+
+// Usage returns the command's arguments.
+func (p *PingCommand) Usage() string {
+	return ""
+}
+
+// Examples returns example invocations.
+func (p *PingCommand) Examples() []string {
+	return nil
+}
+
+// Capability returns the permission needed to run the command.
+func (p *PingCommand) Capability() bot.Capability {
+	return bot.CapabilityView
+}
+
 // Execute runs the command.
 func (p *PingCommand) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
 	s.ChannelMessageSend(m.ChannelID, "Pong!")
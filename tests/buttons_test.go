@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/bot"
+	"hasscord/config"
+	"hasscord/hass"
+	"hasscord/hass/hasstest"
+	"hasscord/sensors"
+)
+
+// buttonPress builds the interaction of a user pressing a button on a message.
+func buttonPress(customID, content string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        "interaction",
+		AppID:     "app",
+		Token:     "token",
+		Type:      discordgo.InteractionMessageComponent,
+		ChannelID: "alerts",
+		User:      &discordgo.User{ID: "alice", Username: "alice"},
+		Message:   &discordgo.Message{Content: content},
+		Data:      discordgo.MessageComponentInteractionData{CustomID: customID, ComponentType: discordgo.ButtonComponent},
+	}}
+}
+
+// alertButtons returns the custom IDs of an alert's buttons by label.
+func alertButtons(t *testing.T, message *discordgo.MessageSend) map[string]string {
+	t.Helper()
+	if len(message.Components) != 1 {
+		t.Fatalf("Expected a row of buttons, got %+v", message.Components)
+	}
+	buttons := make(map[string]string)
+	for _, component := range message.Components[0].(discordgo.ActionsRow).Components {
+		button := component.(discordgo.Button)
+		buttons[button.Label] = button.CustomID
+	}
+	return buttons
+}
+
+// editedContent returns the content a deferred component response was edited to.
+func editedContent(t *testing.T, requests []DiscordRequest) string {
+	t.Helper()
+	if len(requests) != 2 || responseType(requests[0]) != int(discordgo.InteractionResponseDeferredMessageUpdate) {
+		t.Fatalf("Expected a deferred update and an edit, got %+v", requests)
+	}
+	if components, ok := requests[1].Body["components"].([]interface{}); !ok || len(components) != 0 {
+		t.Errorf("Expected the buttons to be removed, got %+v", requests[1].Body)
+	}
+	content, _ := requests[1].Body["content"].(string)
+	return content
+}
+
+func TestAlertButtons(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(doorState("binary_sensor.dvere_garaz", "on"))
+	server.AddState(doorState("binary_sensor.dvere_vchod", "on"))
+	server.AddState(hass.State{EntityID: "cover.dvere_garaz", State: "open"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SubscribeEntities(ctx); err != nil {
+		t.Fatalf("Error subscribing to entities: %v", err)
+	}
+
+	b, err := bot.New(&config.Config{Token: "test_token", Prefix: "!"})
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+	tracker.RegisterButtons(b, client)
+
+	tracker.HandleStateChange("binary_sensor.dvere_garaz", doorState("binary_sensor.dvere_garaz", "on"))
+	tracker.HandleStateChange("binary_sensor.dvere_vchod", doorState("binary_sensor.dvere_vchod", "on"))
+	clock.Advance(15 * time.Second)
+	if len(mockSession.Sent) != 2 {
+		t.Fatalf("Expected 2 alerts, got %d", len(mockSession.Sent))
+	}
+	garage := alertButtons(t, mockSession.Sent[0])
+	front := alertButtons(t, mockSession.Sent[1])
+	if _, ok := front["Close via HA"]; ok {
+		t.Error("Expected no close button without a matching cover or lock")
+	}
+
+	// Acknowledging stops the reminders.
+	discord := newFakeDiscord(b)
+	b.HandleInteraction(b.Session, buttonPress(front["Acknowledge"], "Door open"))
+	if content := editedContent(t, discord.Requests()); content != "Door open\n✅ Acknowledged by **alice**, no more reminders." {
+		t.Errorf("Unexpected acknowledged message %q", content)
+	}
+	if state := tracker.Sensors()["binary_sensor.dvere_vchod"]; state.AckedBy != "alice" {
+		t.Errorf("Expected the alert to be acknowledged by alice, got %q", state.AckedBy)
+	}
+
+	// Snoozing silences reminders for the chosen duration.
+	discord = newFakeDiscord(b)
+	b.HandleInteraction(b.Session, buttonPress(garage["Snooze 1h"], "Door open"))
+	if content := editedContent(t, discord.Requests()); !strings.Contains(content, "💤 Snoozed by **alice** until 13:00.") {
+		t.Errorf("Unexpected snoozed message %q", content)
+	}
+	if state := tracker.Sensors()["binary_sensor.dvere_garaz"]; !state.SnoozedUntil.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("Expected the alert to be snoozed for an hour, got %v", state.SnoozedUntil)
+	}
+
+	// Closing calls Home Assistant only after the press was acknowledged.
+	discord = newFakeDiscord(b)
+	var deferred bool
+	server.ServiceHandler = func(call hasstest.ServiceCall) error {
+		requests := discord.Requests()
+		deferred = len(requests) == 1 && responseType(requests[0]) == int(discordgo.InteractionResponseDeferredMessageUpdate)
+		return nil
+	}
+	b.HandleInteraction(b.Session, buttonPress(garage["Close via HA"], "Door open"))
+	if content := editedContent(t, discord.Requests()); !strings.Contains(content, "🔒 **alice** asked Home Assistant to close `cover.dvere_garaz`.") {
+		t.Errorf("Unexpected closed message %q", content)
+	}
+	if !deferred {
+		t.Error("Expected the press to be acknowledged before calling the service")
+	}
+	calls := server.Calls()
+	if len(calls) != 1 || calls[0].Domain != "cover" || calls[0].Service != "close_cover" || calls[0].Target.EntityID[0] != "cover.dvere_garaz" {
+		t.Errorf("Expected cover.close_cover on cover.dvere_garaz, got %+v", calls)
+	}
+
+	// A failed service call is reported on the message.
+	discord = newFakeDiscord(b)
+	server.ServiceHandler = func(call hasstest.ServiceCall) error {
+		return errors.New("Cover is obstructed")
+	}
+	b.HandleInteraction(b.Session, buttonPress(garage["Close via HA"], "Door open"))
+	if content := editedContent(t, discord.Requests()); !strings.Contains(content, "❌ Failed to close `cover.dvere_garaz`") || !strings.Contains(content, "Cover is obstructed") {
+		t.Errorf("Unexpected failure message %q", content)
+	}
+}
+
+func TestAlertButtonsOfTrackersSharingAChannel(t *testing.T) {
+	windows := config.DefaultRule(15, 60)
+	windows.Name = "windows"
+	windows.Entities = []string{"binary_sensor.okno_*"}
+	windows.Exclude = nil
+
+	doorRules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+	windowRules, err := sensors.CompileRules([]config.Rule{windows}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	b, err := bot.New(&config.Config{Token: "test_token", Prefix: "!"})
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	doorSession, windowSession := &MockSession{}, &MockSession{}
+	doors := sensors.NewTracker(doorSession, "doors", "alerts", clock)
+	doors.SetRules(doorRules)
+	doors.RegisterButtons(b, nil)
+	windowTracker := sensors.NewTracker(windowSession, "windows", "alerts", clock)
+	windowTracker.SetRules(windowRules)
+	windowTracker.RegisterButtons(b, nil)
+
+	doors.HandleStateChange("binary_sensor.dvere_garaz", doorState("binary_sensor.dvere_garaz", "on"))
+	windowTracker.HandleStateChange("binary_sensor.okno_kuchyn", doorState("binary_sensor.okno_kuchyn", "on"))
+	clock.Advance(15 * time.Second)
+	if len(doorSession.Sent) != 1 || len(windowSession.Sent) != 1 {
+		t.Fatalf("Expected an alert from each tracker, got %d and %d", len(doorSession.Sent), len(windowSession.Sent))
+	}
+
+	// Each alert's buttons reach the tracker that sent it.
+	for _, tt := range []struct {
+		tracker  *sensors.Tracker
+		alert    *discordgo.MessageSend
+		entityID string
+	}{
+		{doors, doorSession.Sent[0], "binary_sensor.dvere_garaz"},
+		{windowTracker, windowSession.Sent[0], "binary_sensor.okno_kuchyn"},
+	} {
+		discord := newFakeDiscord(b)
+		b.HandleInteraction(b.Session, buttonPress(alertButtons(t, tt.alert)["Acknowledge"], tt.alert.Content))
+		if content := editedContent(t, discord.Requests()); !strings.Contains(content, "Acknowledged by **alice**") {
+			t.Errorf("Expected %s to be acknowledged, got %q", tt.entityID, content)
+		}
+		if state := tt.tracker.Sensors()[tt.entityID]; state.AckedBy != "alice" {
+			t.Errorf("Expected %s to be acknowledged by alice, got %q", tt.entityID, state.AckedBy)
+		}
+	}
+}
+
+func TestAlertButtonsOmittedForLongEntityIDs(t *testing.T) {
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+
+	entityID := "binary_sensor.dvere_" + strings.Repeat("garaz_", 15)
+	tracker.HandleStateChange(entityID, doorState(entityID, "on"))
+	clock.Advance(15 * time.Second)
+	if len(mockSession.Sent) != 1 {
+		t.Fatalf("Expected the alert to be sent, got %d message(s)", len(mockSession.Sent))
+	}
+	if components := mockSession.Sent[0].Components; components != nil {
+		t.Errorf("Expected no buttons for a long entity ID, got %+v", components)
+	}
+}
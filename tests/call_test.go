@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/commands"
+	"hasscord/hass/hasstest"
+)
+
+func TestCallCommand(t *testing.T) {
+	server, client := newHassClient(t)
+	server.ServiceHandler = func(call hasstest.ServiceCall) error {
+		if call.Domain == "lock" && call.Target.EntityID[0] == "lock.jammed" {
+			return errors.New("Lock is jammed")
+		}
+		return nil
+	}
+
+	callCmd := &commands.Call{HassClient: client}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel", Author: &discordgo.User{Username: "alice"}},
+	}
+
+	mockSession := &MockSession{}
+	callCmd.Execute(mockSession, m, strings.Fields(`light.turn_on light.kitchen brightness=128 transition=1.5 flash=false effect=colorloop rgb_color=[255,0,0]`))
+	if messages := mockSession.Messages(); len(messages) != 1 || !strings.HasPrefix(messages[0], "✅") {
+		t.Fatalf("Expected a confirmation, got %q", messages)
+	}
+	calls := server.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 service call, got %d", len(calls))
+	}
+	call := calls[0]
+	if call.Domain != "light" || call.Service != "turn_on" || !reflect.DeepEqual(call.Target.EntityID, []string{"light.kitchen"}) {
+		t.Errorf("Expected light.turn_on on light.kitchen, got %+v", call)
+	}
+	// Values that are valid JSON keep their type, the rest are strings.
+	expected := map[string]interface{}{
+		"brightness": 128.0,
+		"transition": 1.5,
+		"flash":      false,
+		"effect":     "colorloop",
+		"rgb_color":  []interface{}{255.0, 0.0, 0.0},
+	}
+	if !reflect.DeepEqual(call.Data, expected) {
+		t.Errorf("Expected data %v, got %v", expected, call.Data)
+	}
+
+	tests := []struct {
+		name     string
+		args     string
+		expected string
+	}{
+		{"missing entity", "light.turn_on", "**Usage:**"},
+		{"no service", "light light.kitchen", "**Invalid service: `light`**"},
+		{"empty service", "light. light.kitchen", "**Invalid service: `light.`**"},
+		{"argument without value", "light.turn_on light.kitchen brightness", "invalid argument `brightness`"},
+		{"argument without key", "light.turn_on light.kitchen =128", "invalid argument `=128`"},
+		{"service error", "lock.lock lock.jammed", "Lock is jammed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(server.Calls())
+			mockSession := &MockSession{}
+			callCmd.Execute(mockSession, m, strings.Fields(tt.args))
+			messages := mockSession.Messages()
+			if len(messages) != 1 || !strings.HasPrefix(messages[0], "❌") || !strings.Contains(messages[0], tt.expected) {
+				t.Errorf("Expected an error containing %q, got %q", tt.expected, messages)
+			}
+			if tt.name != "service error" && len(server.Calls()) != before {
+				t.Errorf("Expected no service call for invalid arguments")
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/bot"
+	"hasscord/commands"
+	"hasscord/config"
+	"hasscord/hass"
+	"hasscord/hass/hasstest"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("Error writing config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Setenv("HASS_TOKEN", "env_token")
+
+	path := writeConfig(t, `
+discord:
+  token: discord_token
+channels:
+  alerts: "123"
+hass:
+  url: ws://localhost:8123/api/websocket
+  token: file_token
+schedules:
+  night:
+    - from: "22:00"
+      to: "06:00"
+rules:
+  - name: garage
+    entities: ["cover.garage*"]
+    alert_state: open
+    schedule: night
+  - name: hot
+    trigger:
+      - platform: numeric_state
+        entity_id: sensor.temperature
+        above: 30
+        for: {minutes: 10}
+permissions:
+  pause:
+    roles: ["456"]
+`)
+
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	if cfg.HassToken != "env_token" {
+		t.Errorf("Expected HASS_TOKEN to override the file, got '%s'", cfg.HassToken)
+	}
+	if cfg.Prefix != "!" {
+		t.Errorf("Expected default prefix '!', got '%s'", cfg.Prefix)
+	}
+	if len(cfg.Rules) != 2 || cfg.Rules[0].Name != "garage" {
+		t.Fatalf("Expected the garage and hot rules, got %+v", cfg.Rules)
+	}
+	if trigger := cfg.Rules[1].Trigger; len(trigger) != 1 || trigger[0]["platform"] != "numeric_state" {
+		t.Errorf("Expected the hot rule's trigger, got %v", trigger)
+	}
+
+	night := cfg.Schedules["night"]
+	if !night.Active(time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)) || !night.Active(time.Date(2025, 1, 2, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the night schedule to be active overnight")
+	}
+	if night.Active(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the night schedule to be inactive at noon")
+	}
+}
+
+func TestLoadConfigReportsAllErrors(t *testing.T) {
+	path := writeConfig(t, `
+hass:
+  url: http://localhost:8123
+rules:
+  - name: bad
+    regexes: ["("]
+    schedule: missing
+  - name: hot
+    entities: ["sensor.*"]
+    trigger:
+      - entity_id: sensor.temperature
+        above: 30
+  - name: freezer
+    entities: ["sensor.freezer"]
+    alert_state: "on"
+    above: -15
+    below: -16
+    hysteresis: 1
+permissions:
+  superuser: {}
+`)
+
+	_, err := config.LoadFile(path)
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"discord token", "alert channel", "ws:// or wss://", "home assistant token", "invalid regex", "unknown schedule", "unknown capability", "select entities in their trigger", "trigger 1: platform is required", "alert_state can't be combined", "below plus hysteresis"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention '%s', got:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigTrackers(t *testing.T) {
+	path := writeConfig(t, `
+discord:
+  token: discord_token
+channels:
+  alerts: "123"
+hass:
+  url: ws://localhost:8123/api/websocket
+  token: hass_token
+schedules:
+  night:
+    - from: "22:00"
+      to: "06:00"
+trackers:
+  - name: windows
+    channel: "789"
+    schedules:
+      day:
+        - from: "08:00"
+          to: "20:00"
+    rules:
+      - name: windows
+        entities: ["binary_sensor.okno_*"]
+        schedule: day
+      - name: skylight
+        entities: ["binary_sensor.stresni_okno"]
+        schedule: night
+`)
+
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	trackers := cfg.TrackerConfigs()
+	if len(trackers) != 2 {
+		t.Fatalf("Expected the main and windows trackers, got %+v", trackers)
+	}
+	if trackers[0].Name != config.MainTracker || trackers[0].Channel != "123" || trackers[0].Rules[0].Name != "doors" {
+		t.Errorf("Expected the main tracker with the default rule, got %+v", trackers[0])
+	}
+	windows := trackers[1]
+	if windows.Name != "windows" || windows.Channel != "789" || len(windows.Rules) != 2 {
+		t.Errorf("Expected the windows tracker, got %+v", windows)
+	}
+	if _, ok := windows.Schedules["night"]; !ok {
+		t.Errorf("Expected the global schedules to be added to the tracker's, got %v", windows.Schedules)
+	}
+	if _, ok := cfg.Schedules["day"]; ok {
+		t.Errorf("Expected the tracker's schedules to stay its own, got %v", cfg.Schedules)
+	}
+
+	path = writeConfig(t, `
+discord:
+  token: discord_token
+channels:
+  alerts: "123"
+hass:
+  url: ws://localhost:8123/api/websocket
+  token: hass_token
+trackers:
+  - name: Windows
+    channel: "789"
+    rules:
+      - name: windows
+        entities: ["binary_sensor.okno_*"]
+        schedule: day
+  - name: alerts
+    channel: "789"
+    rules:
+      - name: windows
+        entities: ["binary_sensor.okno_*"]
+  - name: garage
+  - name: garage
+`)
+	_, err = config.LoadFile(path)
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{
+		"tracker Windows: name may only contain",
+		"tracker Windows: rule windows: unknown schedule",
+		"tracker alerts: the name is used",
+		"tracker garage: channel is required",
+		"tracker garage: at least one rule is required",
+		"tracker garage: duplicate name",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention '%s', got:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigRejectsUnknownKeys(t *testing.T) {
+	path := writeConfig(t, `
+discord:
+  tokne: typo
+`)
+
+	_, err := config.LoadFile(path)
+	if err == nil || !strings.Contains(err.Error(), "tokne") {
+		t.Errorf("Expected unknown key error, got %v", err)
+	}
+}
+
+func TestConfigReloadWhileInUse(t *testing.T) {
+	path := writeConfig(t, `
+discord:
+  token: test_token
+  prefix: "!"
+channels:
+  alerts: "123"
+hass:
+  url: ws://homeassistant.local:8123/api/websocket
+  token: hass_token
+`)
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		t.Fatalf("Error loading config file: %v", err)
+	}
+	b, err := bot.New(cfg)
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+
+	reloader := config.NewReloader(path, func(newCfg *config.Config) error {
+		if restart := cfg.Update(newCfg); len(restart) > 0 {
+			t.Errorf("Expected no restart, got %v", restart)
+		}
+		return nil
+	})
+
+	// Readers run concurrently with reloads, as the bot's handlers do.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			b.Allowed(&discordgo.User{ID: "guest"}, nil, bot.CapabilityView)
+			_ = cfg.CommandPrefix()
+			_ = cfg.String()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := reloader.Reload(); err != nil {
+			t.Fatalf("Error reloading config: %v", err)
+		}
+	}
+	<-done
+
+	os.WriteFile(path, []byte(`
+discord:
+  token: test_token
+  prefix: "?"
+channels:
+  alerts: "123"
+hass:
+  url: ws://homeassistant.local:8123/api/websocket
+  token: hass_token
+permissions:
+  admin:
+    users: [owner]
+`), 0o600)
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Error reloading config: %v", err)
+	}
+	if prefix := cfg.CommandPrefix(); prefix != "?" {
+		t.Errorf("Expected the reloaded prefix, got %q", prefix)
+	}
+	if grants := cfg.Grants(); len(grants) != 1 || grants["admin"].Users[0] != "owner" {
+		t.Errorf("Expected the reloaded permissions, got %+v", grants)
+	}
+}
+
+func TestConfigCommandChecksHomeAssistant(t *testing.T) {
+	server := hasstest.NewServer()
+	defer server.Close()
+	restClient, err := hass.NewRESTClient(server.URL(), hasstest.Token)
+	if err != nil {
+		t.Fatalf("Error creating REST client: %v", err)
+	}
+
+	configCmd := &commands.Config{Config: &config.Config{}, RESTClient: restClient}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel"},
+	}
+	run := func(args ...string) string {
+		t.Helper()
+		mockSession := &MockSession{}
+		configCmd.Execute(mockSession, m, args)
+		messages := mockSession.Messages()
+		if len(messages) != 1 {
+			t.Fatalf("Expected one message for %q, got %q", args, messages)
+		}
+		return messages[0]
+	}
+
+	if msg := run("check"); !strings.Contains(msg, "configuration is valid") {
+		t.Errorf("Expected a valid configuration, got %q", msg)
+	}
+	server.ConfigErrors = "Integration error: foo"
+	if msg := run("check"); !strings.Contains(msg, "is invalid") || !strings.Contains(msg, "Integration error: foo") {
+		t.Errorf("Expected the configuration errors, got %q", msg)
+	}
+
+	if msg := run("log"); !strings.Contains(msg, "error log is empty") {
+		t.Errorf("Expected an empty error log, got %q", msg)
+	}
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("ERROR (MainThread) [homeassistant] Something broke %d", i))
+	}
+	server.ErrorLog = strings.Join(lines, "\n")
+	msg := run("log")
+	if len(msg) > 2000 || !strings.Contains(msg, "Something broke 199\n```") || strings.Contains(msg, "Something broke 0\n") {
+		t.Errorf("Expected the end of the error log within the message limit, got %d bytes: %q", len(msg), msg)
+	}
+	if !strings.Contains(msg, "```\nERROR") {
+		t.Errorf("Expected the log to start with a whole line, got %q", msg)
+	}
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/commands"
+	"hasscord/hass"
+)
+
+func TestGraphCommand(t *testing.T) {
+	server, client := newHassClient(t)
+
+	now := time.Now()
+	for i, value := range []string{"18.5", "19.25", "unavailable", "21", "20.5"} {
+		server.AddState(hass.State{
+			EntityID:    "sensor.outdoor_temperature",
+			State:       value,
+			Attributes:  map[string]interface{}{"friendly_name": "Outdoor", "unit_of_measurement": "°C"},
+			LastChanged: now.Add(time.Duration(i-5) * 4 * time.Hour).UTC().Format(time.RFC3339Nano),
+		})
+	}
+	for i, state := range []string{"off", "on", "off", "on", "off"} {
+		door := doorState("binary_sensor.dvere_vchod", state)
+		door.Attributes["friendly_name"] = "Front door"
+		door.LastChanged = now.Add(time.Duration(i-4) * 3 * time.Hour).UTC().Format(time.RFC3339Nano)
+		server.AddState(door)
+	}
+	server.AddState(hass.State{EntityID: "sun.sun", State: "above_horizon"})
+	_, err := client.GetStates(context.Background())
+	if err != nil {
+		t.Fatalf("Error getting states: %v", err)
+	}
+
+	graphCmd := &commands.Graph{HassClient: client}
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: "test_channel"}}
+
+	mockSession := &MockSession{}
+	graphCmd.Execute(mockSession, m, []string{"sensor.outdoor_temperature", "binary_sensor.dvere_vchod", "24h"})
+	if len(mockSession.Sent) != 1 || len(mockSession.Sent[0].Files) != 1 {
+		t.Fatalf("Expected a message with an attachment, got %+v", mockSession.Sent)
+	}
+	sent := mockSession.Sent[0]
+	if !strings.Contains(sent.Content, "**Outdoor**, **Front door**") {
+		t.Errorf("Unexpected content %q", sent.Content)
+	}
+
+	file := sent.Files[0]
+	img, err := png.Decode(file.Reader)
+	if err != nil {
+		t.Fatalf("Error decoding graph: %v", err)
+	}
+	if path := os.Getenv("GRAPH_OUTPUT"); path != "" {
+		out, _ := os.Create(path)
+		png.Encode(out, img)
+		out.Close()
+	}
+	if file.ContentType != "image/png" || img.Bounds().Dx() != 800 {
+		t.Errorf("Unexpected image %s %v", file.ContentType, img.Bounds())
+	}
+
+	// The door's on periods and the temperature line are both drawn.
+	colors := make(map[string]bool)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			colors[fmt.Sprintf("%02x%02x%02x", r>>8, g>>8, b>>8)] = true
+		}
+	}
+	for name, want := range map[string]color.RGBA{"on bar": {0xdc, 0x26, 0x26, 0xff}, "line": {0x25, 0x63, 0xeb, 0xff}} {
+		if !colors[fmt.Sprintf("%02x%02x%02x", want.R, want.G, want.B)] {
+			t.Errorf("Expected the %s to be drawn", name)
+		}
+	}
+
+	for _, args := range [][]string{{}, {"sensor.missing"}, {"sun.sun"}} {
+		mockSession = &MockSession{}
+		graphCmd.Execute(mockSession, m, args)
+		if messages := mockSession.Messages(); len(messages) != 1 || !strings.HasPrefix(messages[0], "❌") {
+			t.Errorf("Expected an error for %q, got %q", args, messages)
+		}
+	}
+}
+
+func TestGraphAutocompleteTruncatesNames(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(hass.State{EntityID: "sensor.teplota_loznice", State: "21.5"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SubscribeEntities(ctx); err != nil {
+		t.Fatalf("Error subscribing to entities: %v", err)
+	}
+
+	// Earlier entities are kept in the value, the label is cut to 100 bytes.
+	prefix := strings.Repeat("sensor.čidlo_ložnice ", 5)
+	graphCmd := &commands.Graph{HassClient: client}
+	choices := graphCmd.Autocomplete("entities", prefix+"loznice")
+	if len(choices) != 1 {
+		t.Fatalf("Expected 1 choice, got %d", len(choices))
+	}
+	if label := choices[0].Name; len(label) > 100 || !utf8.ValidString(label) || !strings.HasPrefix(label, prefix[:20]) {
+		t.Errorf("Expected a valid label of at most 100 bytes, got %q (%d bytes)", label, len(label))
+	}
+	if choices[0].Value != prefix+"sensor.teplota_loznice" {
+		t.Errorf("Expected the entities as the value, got %v", choices[0].Value)
+	}
+}
@@ -0,0 +1,449 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"hasscord/hass"
+	"hasscord/hass/hasstest"
+)
+
+// newHassClient starts a fake Home Assistant server and a listening client
+// connected to it. Both are closed when the test ends.
+func newHassClient(t *testing.T) (*hasstest.Server, *hass.Client) {
+	t.Helper()
+
+	server := hasstest.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := server.Client()
+	if err != nil {
+		t.Fatalf("Error connecting to fake Home Assistant: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	go client.Listen()
+	return server, client
+}
+
+// waitFor polls cond until it returns true or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// receiveEvent waits for the next event on the channel.
+func receiveEvent(t *testing.T, events <-chan hass.Event) hass.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for event")
+		return hass.Event{}
+	}
+}
+
+func doorState(id, state string) hass.State {
+	return hass.State{
+		EntityID:   id,
+		State:      state,
+		Attributes: map[string]interface{}{"device_class": "door"},
+	}
+}
+
+func TestAuthenticateRejectsInvalidToken(t *testing.T) {
+	server := hasstest.NewServer()
+	defer server.Close()
+
+	client, err := hass.New(server.URL(), "wrong-token")
+	if err != nil {
+		t.Fatalf("Error connecting to fake Home Assistant: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Authenticate(); err == nil {
+		t.Fatal("Expected authentication to fail")
+	}
+}
+
+func TestClientGetStatesAndCallService(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(doorState("binary_sensor.dvere_garaz", "on"))
+	server.AddState(hass.State{EntityID: "cover.dvere_garaz", State: "open"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	states, err := client.GetStates(ctx)
+	if err != nil {
+		t.Fatalf("Error getting states: %v", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("Expected 2 states, got %d", len(states))
+	}
+	if _, ok := client.States.Get("cover.dvere_garaz"); !ok {
+		t.Error("Expected GetStates to fill the state cache")
+	}
+
+	resp, err := client.CallService(ctx, "cover", "close_cover", &hass.Target{EntityID: []string{"cover.dvere_garaz"}}, map[string]interface{}{"position": 0})
+	if err != nil {
+		t.Fatalf("Error calling service: %v", err)
+	}
+	if resp.Context.ID == "" {
+		t.Error("Expected the service response to carry a context")
+	}
+
+	calls := server.Calls()
+	if len(calls) != 1 || calls[0].Domain != "cover" || calls[0].Service != "close_cover" || calls[0].Target.EntityID[0] != "cover.dvere_garaz" {
+		t.Errorf("Unexpected service calls: %+v", calls)
+	}
+}
+
+func TestClientDoErrors(t *testing.T) {
+	server, client := newHassClient(t)
+	server.ServiceHandler = func(call hasstest.ServiceCall) error {
+		return fmt.Errorf("Entity %s is offline", call.Target.EntityID[0])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.Do(ctx, map[string]interface{}{"type": "no_such_command"})
+	if !errors.Is(err, hass.ErrUnknownCommand) {
+		t.Errorf("Expected ErrUnknownCommand, got %v", err)
+	}
+
+	_, err = client.CallService(ctx, "cover", "close_cover", &hass.Target{EntityID: []string{"cover.dvere_garaz"}}, nil)
+	if !errors.Is(err, hass.ErrHomeAssistant) {
+		t.Errorf("Expected ErrHomeAssistant, got %v", err)
+	}
+	var resultErr *hass.ResultError
+	if !errors.As(err, &resultErr) || resultErr.Message != "Entity cover.dvere_garaz is offline" {
+		t.Errorf("Expected the Home Assistant error message, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.Do(cancelled, map[string]interface{}{"type": "get_states"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestClientDoConcurrent(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(doorState("binary_sensor.dvere_garaz", "on"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetStates(ctx)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Error getting states: %v", err)
+		}
+	}
+}
+
+func TestClientReceivesEventsAcrossReconnect(t *testing.T) {
+	server, client := newHassClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := client.Subscribe(ctx, "")
+	if err != nil {
+		t.Fatalf("Error subscribing to events: %v", err)
+	}
+	events := sub.Events()
+
+	server.SetState(doorState("binary_sensor.dvere_garaz", "on"))
+	if event := receiveEvent(t, events); event.EventType != "state_changed" {
+		t.Fatalf("Expected state_changed event, got %s", event.EventType)
+	}
+	waitFor(t, time.Second, "state cache update", func() bool {
+		state, ok := client.States.Get("binary_sensor.dvere_garaz")
+		return ok && state.State == "on"
+	})
+
+	server.DropConnections()
+	waitFor(t, time.Second, "disconnect", func() bool { return server.Subscriptions() == 0 })
+	waitFor(t, 5*time.Second, "resubscription", func() bool { return server.Subscriptions() == 1 })
+
+	server.SetState(doorState("binary_sensor.dvere_garaz", "off"))
+	if event := receiveEvent(t, events); event.EventType != "state_changed" {
+		t.Fatalf("Expected state_changed event after reconnect, got %s", event.EventType)
+	}
+}
+
+func TestClientFilteredSubscriptions(t *testing.T) {
+	server, client := newHassClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	states, err := client.Subscribe(ctx, "state_changed")
+	if err != nil {
+		t.Fatalf("Error subscribing to state_changed: %v", err)
+	}
+	custom, err := client.Subscribe(ctx, "custom_event")
+	if err != nil {
+		t.Fatalf("Error subscribing to custom_event: %v", err)
+	}
+
+	server.SendEvent("custom_event", map[string]string{"hello": "world"})
+	server.SetState(doorState("binary_sensor.dvere_garaz", "on"))
+
+	if event := receiveEvent(t, custom.Events()); event.EventType != "custom_event" {
+		t.Errorf("Expected custom_event, got %s", event.EventType)
+	}
+	if event := receiveEvent(t, states.Events()); event.EventType != "state_changed" {
+		t.Errorf("Expected state_changed, got %s", event.EventType)
+	}
+
+	// Unsubscribing closes the channel and ends the server-side subscription.
+	err = custom.Unsubscribe(ctx)
+	if err != nil {
+		t.Fatalf("Error unsubscribing: %v", err)
+	}
+	if _, ok := <-custom.Events(); ok {
+		t.Error("Expected the unsubscribed channel to be closed")
+	}
+	waitFor(t, time.Second, "unsubscribe", func() bool { return server.Subscriptions() == 1 })
+}
+
+func TestClientDropsOldestEventsWhenConsumerLags(t *testing.T) {
+	server, client := newHassClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Nobody reads this subscription, so it overflows.
+	slow, err := client.Subscribe(ctx, "state_changed")
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+
+	const events = 300
+	for i := 0; i < events; i++ {
+		server.SetState(hass.State{EntityID: "sensor.counter", State: fmt.Sprint(i)})
+	}
+
+	// The reader keeps going: requests still get answered and the cache is current.
+	waitFor(t, 5*time.Second, "state cache update", func() bool {
+		state, ok := client.States.Get("sensor.counter")
+		return ok && state.State == fmt.Sprint(events-1)
+	})
+	if _, err := client.GetStates(ctx); err != nil {
+		t.Fatalf("Error getting states: %v", err)
+	}
+
+	if slow.Dropped() == 0 {
+		t.Error("Expected events to be dropped")
+	}
+	select {
+	case <-slow.Overflows():
+	default:
+		t.Error("Expected the overflow to be signalled")
+	}
+	var last hass.StateChangedData
+	for len(slow.Events()) > 0 {
+		event := <-slow.Events()
+		json.Unmarshal(event.Data, &last)
+	}
+	if last.NewState.State != fmt.Sprint(events-1) {
+		t.Errorf("Expected the newest event to be kept, got state %q", last.NewState.State)
+	}
+}
+
+func TestClientSubscribeEntities(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(doorState("binary_sensor.dvere_garaz", "off"))
+	server.AddState(hass.State{EntityID: "light.garaz", State: "on", Attributes: map[string]interface{}{"brightness": 255.0}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := client.SubscribeEntities(ctx)
+	if err != nil {
+		t.Fatalf("Error subscribing to entities: %v", err)
+	}
+	if states := client.States.All(); len(states) != 2 {
+		t.Fatalf("Expected the snapshot to fill the cache with 2 states, got %d", len(states))
+	}
+
+	// Diffs update the cache and arrive as state_changed events.
+	server.SetState(doorState("binary_sensor.dvere_garaz", "on"))
+	event := receiveEvent(t, sub.Events())
+	var change hass.StateChangedData
+	json.Unmarshal(event.Data, &change)
+	if event.EventType != "state_changed" || change.NewState.State != "on" || change.OldState.State != "off" {
+		t.Fatalf("Unexpected change event %s: %+v", event.EventType, change)
+	}
+	if change.NewState.Attributes["device_class"] != "door" || change.NewState.LastChangedTime().IsZero() {
+		t.Errorf("Expected the diff to keep attributes and timestamps, got %+v", change.NewState)
+	}
+
+	server.SetState(hass.State{EntityID: "light.garaz", State: "on", Attributes: map[string]interface{}{"color_mode": "xy"}})
+	receiveEvent(t, sub.Events())
+	light, _ := client.States.Get("light.garaz")
+	if _, ok := light.Attributes["brightness"]; ok || light.Attributes["color_mode"] != "xy" {
+		t.Errorf("Expected attributes to be replaced, got %v", light.Attributes)
+	}
+
+	server.RemoveState("light.garaz")
+	receiveEvent(t, sub.Events())
+	if _, ok := client.States.Get("light.garaz"); ok {
+		t.Error("Expected the removed entity to leave the cache")
+	}
+
+	// Changes made while disconnected are caught up from the new snapshot.
+	server.DropConnections()
+	server.AddState(doorState("binary_sensor.dvere_garaz", "off"))
+	event = receiveEvent(t, sub.Events())
+	json.Unmarshal(event.Data, &change)
+	if change.EntityID != "binary_sensor.dvere_garaz" || change.NewState.State != "off" {
+		t.Errorf("Expected the missed change after reconnect, got %+v", change)
+	}
+}
+
+func TestClientFailsPendingRequestsWhenConnectionDrops(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(doorState("binary_sensor.dvere_garaz", "on"))
+
+	reconnected := make(chan []hass.State, 1)
+	client.OnReconnect(func(states []hass.State) { reconnected <- states })
+
+	// The service call never gets a result before the connection drops.
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	server.ServiceHandler = func(call hasstest.ServiceCall) error {
+		close(entered)
+		<-release
+		return nil
+	}
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.CallService(ctx, "cover", "close_cover", nil, nil)
+		result <- err
+	}()
+	<-entered
+	server.DropConnections()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, hass.ErrConnectionLost) {
+			t.Errorf("Expected ErrConnectionLost, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the pending request to fail")
+	}
+
+	select {
+	case states := <-reconnected:
+		if len(states) != 1 || states[0].EntityID != "binary_sensor.dvere_garaz" {
+			t.Errorf("Expected the reconnect handler to get the current states, got %+v", states)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the reconnect handler")
+	}
+}
+
+func TestClientReconnectAuthenticatesBeforeUseAndClosesRefusedSubscriptions(t *testing.T) {
+	server, client := newHassClient(t)
+
+	reconnected := make(chan struct{}, 1)
+	client.OnReconnect(func(states []hass.State) { reconnected <- struct{}{} })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	kept, err := client.Subscribe(ctx, "state_changed")
+	if err != nil {
+		t.Fatalf("Error subscribing to state_changed: %v", err)
+	}
+	refused, err := client.Subscribe(ctx, "automation_triggered")
+	if err != nil {
+		t.Fatalf("Error subscribing to automation_triggered: %v", err)
+	}
+
+	server.SubscribeHandler = func(eventType string) error {
+		if eventType == "automation_triggered" {
+			return errors.New("Unauthorized")
+		}
+		return nil
+	}
+	server.AuthDelay = 300 * time.Millisecond
+	server.DropConnections()
+
+	// Requests made while the client reconnects must not reach the new
+	// connection before it is authenticated.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			reqCtx, reqCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			client.GetStates(reqCtx)
+			reqCancel()
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the reconnect")
+	}
+	close(stop)
+	wg.Wait()
+
+	select {
+	case _, ok := <-refused.Events():
+		if ok {
+			t.Fatal("Expected no event on the refused subscription")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the refused subscription to close")
+	}
+
+	server.SetState(doorState("binary_sensor.dvere_garaz", "on"))
+	if event := receiveEvent(t, kept.Events()); event.EventType != "state_changed" {
+		t.Fatalf("Expected state_changed event after reconnect, got %s", event.EventType)
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/bot"
+	"hasscord/commands"
+	"hasscord/config"
+)
+
+func TestHelpHonorsPermissions(t *testing.T) {
+	cfg := &config.Config{
+		Token:       "test_token",
+		Prefix:      "!",
+		Permissions: map[string]config.Grant{"view": {Everyone: true}, "pause": {Roles: []string{"family"}}},
+	}
+	b, err := bot.New(cfg)
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+	b.RegisterCommand(&PingCommand{})
+	b.RegisterCommand(&commands.Pause{})
+
+	helpCmd, ok := b.Commands["help"]
+	if !ok {
+		t.Fatal("Expected the help command to be registered")
+	}
+
+	guest := &discordgo.MessageCreate{Message: &discordgo.Message{
+		ChannelID: "test_channel",
+		Author:    &discordgo.User{ID: "guest"},
+		Member:    &discordgo.Member{},
+	}}
+	mockSession := &MockSession{}
+	helpCmd.Execute(mockSession, guest, nil)
+
+	embed := mockSession.Sent[0].Embeds[0]
+	var names []string
+	for _, field := range embed.Fields {
+		names = append(names, field.Name)
+	}
+	listed := strings.Join(names, "\n")
+	if !strings.Contains(listed, "!ping") || !strings.Contains(listed, "!help [command]") {
+		t.Errorf("Expected ping and help to be listed, got:\n%s", listed)
+	}
+	if strings.Contains(listed, "!pause") {
+		t.Errorf("Expected pause to be hidden from users without the pause permission, got:\n%s", listed)
+	}
+
+	helpCmd.Execute(mockSession, guest, []string{"pause"})
+	if !strings.Contains(mockSession.Message, "Unknown command") {
+		t.Errorf("Expected help for a forbidden command to be refused, got %q", mockSession.Message)
+	}
+
+	family := &discordgo.MessageCreate{Message: &discordgo.Message{
+		ChannelID: "test_channel",
+		Author:    &discordgo.User{ID: "member"},
+		Member:    &discordgo.Member{Roles: []string{"family"}},
+	}}
+	helpCmd.Execute(mockSession, family, []string{"pause"})
+
+	sent := mockSession.Sent[len(mockSession.Sent)-1]
+	if len(sent.Embeds) != 1 || sent.Embeds[0].Title != "📖 !pause" {
+		t.Fatalf("Expected the pause help embed, got %+v", sent)
+	}
+	if fields := sent.Embeds[0].Fields; len(fields) != 2 || !strings.Contains(fields[1].Value, "`!pause *garaz* 2h`") {
+		t.Errorf("Expected usage and examples fields, got %+v", fields)
+	}
+}
+
+func TestHelpAutocompleteHonorsPermissions(t *testing.T) {
+	cfg := &config.Config{
+		Token:       "test_token",
+		Prefix:      "!",
+		Permissions: map[string]config.Grant{"view": {Everyone: true}, "pause": {Users: []string{"member"}}},
+	}
+	b, err := bot.New(cfg)
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+	b.RegisterCommand(&PingCommand{})
+	b.RegisterCommand(&commands.Pause{})
+
+	suggest := func(userID string) []string {
+		t.Helper()
+		discord := newFakeDiscord(b)
+		i := slashInteraction(discordgo.InteractionApplicationCommandAutocomplete, "help", stringOption("command", "p", true))
+		i.User = &discordgo.User{ID: userID}
+		b.HandleInteraction(b.Session, i)
+		requests := discord.Requests()
+		if len(requests) != 1 {
+			t.Fatalf("Expected an autocomplete result, got %+v", requests)
+		}
+		choices, _ := responseData(requests[0])["choices"].([]interface{})
+		var names []string
+		for _, choice := range choices {
+			names = append(names, choice.(map[string]interface{})["value"].(string))
+		}
+		return names
+	}
+
+	if names := suggest("guest"); strings.Join(names, ",") != "ping" {
+		t.Errorf("Expected only ping to be suggested to a guest, got %q", names)
+	}
+	if names := suggest("member"); strings.Join(names, ",") != "pause,ping" {
+		t.Errorf("Expected pause and ping to be suggested to a member, got %q", names)
+	}
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/commands"
+	"hasscord/hass"
+)
+
+func TestHistoryCommand(t *testing.T) {
+	server, client := newHassClient(t)
+	ctx := context.Background()
+
+	server.AddState(hass.State{
+		EntityID:   "person.alice",
+		State:      "home",
+		Attributes: map[string]interface{}{"friendly_name": "Alice", "user_id": "0123456789abcdef"},
+	})
+	now := time.Now()
+	for i, change := range []struct {
+		state  string
+		ago    time.Duration
+		userID string
+	}{
+		{"off", 30 * time.Hour, ""},
+		{"on", 3 * time.Hour, "0123456789abcdef"},
+		{"on", 2 * time.Hour, ""}, // attribute update
+		{"off", 90 * time.Minute, "fedcba9876543210"},
+	} {
+		door := doorState("binary_sensor.dvere_zadni", change.state)
+		door.Attributes["friendly_name"] = "Back door"
+		door.Attributes["update"] = i
+		door.LastChanged = now.Add(-change.ago).UTC().Format(time.RFC3339Nano)
+		door.Context.UserID = change.userID
+		server.AddState(door)
+	}
+	_, err := client.GetStates(ctx)
+	if err != nil {
+		t.Fatalf("Error getting states: %v", err)
+	}
+
+	history, err := client.History(ctx, now.Add(-24*time.Hour), now, "binary_sensor.dvere_zadni")
+	if err != nil {
+		t.Fatalf("Error getting history: %v", err)
+	}
+	if states := history["binary_sensor.dvere_zadni"]; len(states) != 4 || states[0].State != "off" || states[1].Attributes["friendly_name"] != "Back door" {
+		t.Errorf("Unexpected history %+v", history)
+	}
+	entries, err := client.Logbook(ctx, now.Add(-24*time.Hour), now, "binary_sensor.dvere_zadni")
+	if err != nil {
+		t.Fatalf("Error getting logbook: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ContextUserID != "0123456789abcdef" || entries[0].WhenTime().IsZero() {
+		t.Errorf("Unexpected logbook %+v", entries)
+	}
+
+	historyCmd := &commands.History{HassClient: client}
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: "test_channel"}}
+
+	mockSession := &MockSession{}
+	historyCmd.Execute(mockSession, m, []string{"binary_sensor.dvere_zadni"})
+	messages := mockSession.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected one message, got %q", messages)
+	}
+	lines := strings.Split(strings.TrimSpace(messages[0]), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], "**Back door**") {
+		t.Fatalf("Expected a header and three changes, got %q", messages[0])
+	}
+	for i, want := range []string{
+		"**off** for 21h 0m",
+		"**on** for 1h 30m · 👤 Alice",
+		"**off** for 1h 30m (now) · 👤 user `fedcba98`",
+	} {
+		if !strings.Contains(lines[i+1], want) {
+			t.Errorf("Line %d = %q, want it to contain %q", i+1, lines[i+1], want)
+		}
+	}
+
+	for _, args := range [][]string{{}, {"sensor.missing"}, {"binary_sensor.dvere_zadni", "soon"}} {
+		mockSession = &MockSession{}
+		historyCmd.Execute(mockSession, m, args)
+		if messages := mockSession.Messages(); len(messages) != 1 || !strings.HasPrefix(messages[0], "❌") {
+			t.Errorf("Expected an error for %q, got %q", args, messages)
+		}
+	}
+}
+
+func TestHistoryCommandFitsMessage(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(hass.State{
+		EntityID:   "person.alice",
+		State:      "home",
+		Attributes: map[string]interface{}{"friendly_name": strings.Repeat("Alice ", 25), "user_id": "0123456789abcdef"},
+	})
+	now := time.Now()
+	for i := 0; i < 30; i++ {
+		door := doorState("binary_sensor.dvere_zadni", []string{"off", "on"}[i%2])
+		door.LastChanged = now.Add(time.Duration(i-30) * time.Minute).UTC().Format(time.RFC3339Nano)
+		door.Context.UserID = "0123456789abcdef"
+		server.AddState(door)
+	}
+	if _, err := client.GetStates(context.Background()); err != nil {
+		t.Fatalf("Error getting states: %v", err)
+	}
+
+	historyCmd := &commands.History{HassClient: client}
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: "test_channel"}}
+	mockSession := &MockSession{}
+	historyCmd.Execute(mockSession, m, []string{"binary_sensor.dvere_zadni"})
+	messages := mockSession.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected one message, got %q", messages)
+	}
+	if len(messages[0]) > 2000 {
+		t.Errorf("Expected at most 2000 bytes, got %d", len(messages[0]))
+	}
+
+	// The newest changes are shown and the older ones counted.
+	lines := strings.Split(strings.TrimSpace(messages[0]), "\n")
+	var skipped int
+	if _, err := fmt.Sscanf(lines[1], "… %d earlier change(s)", &skipped); err != nil {
+		t.Fatalf("Expected the earlier changes to be counted, got %q", lines[1])
+	}
+	if shown := len(lines) - 2; shown+skipped != 30 || shown >= 25 {
+		t.Errorf("Expected fewer than 25 of 30 changes shown, got %d shown and %d skipped", shown, skipped)
+	}
+	if last := lines[len(lines)-1]; !strings.Contains(last, "(now)") {
+		t.Errorf("Expected the current state last, got %q", last)
+	}
+}
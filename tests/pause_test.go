@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/commands"
+	"hasscord/config"
+	"hasscord/hass"
+	"hasscord/sensors"
+)
+
+func TestPauseCommandPattern(t *testing.T) {
+	mockSession := &MockSession{}
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	pauseCmd := &commands.Pause{Trackers: []*sensors.Tracker{tracker}}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ChannelID: "test_channel",
+			Author:    &discordgo.User{Username: "alice"},
+		},
+	}
+
+	pauseCmd.Execute(mockSession, m, []string{"*garaz*", "2h"})
+
+	pauses := tracker.Pauses()
+	if len(pauses) != 1 {
+		t.Fatalf("Expected 1 pause, got %d", len(pauses))
+	}
+	if pauses[0].Pattern != "*garaz*" || pauses[0].By != "alice" {
+		t.Errorf("Unexpected pause: %+v", pauses[0])
+	}
+	if want := clock.Now().Add(2 * time.Hour); !pauses[0].Until.Equal(want) {
+		t.Errorf("Expected pause to end at %s by the tracker's clock, ends at %s", want, pauses[0].Until)
+	}
+	if !pauses[0].Matches("binary_sensor.dvere_garaz") || pauses[0].Matches("binary_sensor.dvere_vchod") {
+		t.Errorf("Pause matched the wrong entities")
+	}
+
+	pauseCmd.Execute(mockSession, m, []string{"off", "*garaz*"})
+
+	if len(tracker.Pauses()) != 0 {
+		t.Errorf("Expected pause to be removed, got %+v", tracker.Pauses())
+	}
+
+	// Words that are neither actions, globs nor known entities are rejected.
+	mockSession = &MockSession{}
+	pauseCmd.Execute(mockSession, m, []string{"of"})
+	if messages := mockSession.Messages(); len(messages) != 1 || !strings.Contains(messages[0], "Unknown action or entity `of`") {
+		t.Errorf("Expected an unknown action error, got %q", messages)
+	}
+	if len(tracker.Pauses()) != 0 {
+		t.Errorf("Expected no pause for an unknown word, got %+v", tracker.Pauses())
+	}
+
+	// Tracked entities can be paused by ID.
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+	tracker.SetRules(rules)
+	tracker.HandleStateChange("binary_sensor.dvere_garaz", doorState("binary_sensor.dvere_garaz", "on"))
+	pauseCmd.Execute(mockSession, m, []string{"Binary_Sensor.Dvere_Garaz", "until", "18:00"})
+	pauses = tracker.Pauses()
+	if len(pauses) != 1 || pauses[0].Pattern != "binary_sensor.dvere_garaz" || !pauses[0].Until.Equal(time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the entity to be paused until 18:00, got %+v", pauses)
+	}
+}
+
+func TestPauseCommandObjectID(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(doorState("binary_sensor.dvere_vchod", "off"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SubscribeEntities(ctx); err != nil {
+		t.Fatalf("Error subscribing to entities: %v", err)
+	}
+
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	tracker := sensors.NewTracker(&MockSession{}, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+	tracker.HandleStateChange("binary_sensor.dvere_garaz", doorState("binary_sensor.dvere_garaz", "on"))
+
+	pauseCmd := &commands.Pause{HassClient: client, Trackers: []*sensors.Tracker{tracker}}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel", Author: &discordgo.User{Username: "alice"}},
+	}
+
+	// Object IDs of tracked entities and of entities Home Assistant has are known.
+	for _, target := range []string{"dvere_garaz", "Dvere_Vchod"} {
+		mockSession := &MockSession{}
+		pauseCmd.Execute(mockSession, m, []string{target, "2h"})
+		if messages := mockSession.Messages(); len(messages) != 1 || !strings.Contains(messages[0], "Notifications PAUSED") {
+			t.Errorf("Expected %s to be paused, got %q", target, messages)
+		}
+	}
+	pauses := tracker.Pauses()
+	if len(pauses) != 2 || !pauses[0].Matches("binary_sensor.dvere_garaz") || !pauses[1].Matches("binary_sensor.dvere_vchod") {
+		t.Errorf("Expected pauses of both entities, got %+v", pauses)
+	}
+}
+
+func TestPausesRestoredFromState(t *testing.T) {
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	store := &MemoryStore{snapshot: sensors.Snapshot{
+		Sensors: []sensors.SavedSensor{
+			{EntityID: "binary_sensor.dvere_garaz", Rule: "doors", State: "on", OnTime: now.Add(-time.Minute)},
+		},
+		Pauses: []sensors.Pause{
+			{Pattern: "*garaz*", Until: now.Add(10 * time.Minute), By: "alice", Created: now.Add(-time.Hour)},
+			{Pattern: "*sklep*", Until: now.Add(-time.Minute), By: "alice", Created: now.Add(-2 * time.Hour)},
+			{Pattern: "binary_sensor.dvere_vchod", By: "bob", Created: now.Add(-time.Hour)},
+		},
+	}}
+
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+	tracker.SetStore(store)
+	tracker.RestoreState([]hass.State{doorState("binary_sensor.dvere_garaz", "on")})
+
+	// The overdue door stays silent while its pause lasts, and a pause that
+	// ended while the bot was down ends as soon as timers run.
+	clock.Advance(0)
+	messages := mockSession.Messages()
+	if len(messages) != 1 || !strings.Contains(messages[0], "Pause ended** for `*sklep*`") {
+		t.Fatalf("Expected only the expired pause to be announced, got %q", messages)
+	}
+	pauses := tracker.Pauses()
+	if len(pauses) != 2 || pauses[0].Pattern != "*garaz*" || pauses[1].Pattern != "binary_sensor.dvere_vchod" {
+		t.Fatalf("Expected the active pauses to be restored, got %+v", pauses)
+	}
+
+	clock.Advance(10 * time.Minute)
+	messages = mockSession.Messages()
+	if len(messages) != 3 || !strings.Contains(messages[1], "Pause ended** for `*garaz*`") || !strings.Contains(messages[2], "dvere_garaz") {
+		t.Fatalf("Expected the pause to end and the door to alert after 10 minutes, got %q", messages)
+	}
+	if pauses := store.snapshot.Pauses; len(pauses) != 1 || pauses[0].Pattern != "binary_sensor.dvere_vchod" || !pauses[0].Until.IsZero() {
+		t.Errorf("Expected only the indefinite pause to stay saved, got %+v", pauses)
+	}
+}
+
+func TestPauseCommandAppliesToAllTrackers(t *testing.T) {
+	windows := config.DefaultRule(15, 60)
+	windows.Name = "windows"
+	windows.Entities = []string{"binary_sensor.okno_*"}
+	windows.Exclude = nil
+	windowRules, err := sensors.CompileRules([]config.Rule{windows}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	doors := sensors.NewTracker(&MockSession{}, "doors", "alerts", clock)
+	windowTracker := sensors.NewTracker(&MockSession{}, "windows", "windows", clock)
+	windowTracker.SetRules(windowRules)
+	windowTracker.HandleStateChange("binary_sensor.okno_kuchyn", doorState("binary_sensor.okno_kuchyn", "on"))
+
+	pauseCmd := &commands.Pause{Trackers: []*sensors.Tracker{doors, windowTracker}}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel", Author: &discordgo.User{Username: "alice"}},
+	}
+
+	// Entities tracked by any tracker can be paused, and the pause applies to all of them.
+	mockSession := &MockSession{}
+	pauseCmd.Execute(mockSession, m, []string{"okno_kuchyn", "2h"})
+	for _, tracker := range []*sensors.Tracker{doors, windowTracker} {
+		if pauses := tracker.Pauses(); len(pauses) != 1 || pauses[0].Pattern != "okno_kuchyn" {
+			t.Errorf("Expected tracker %s to have the pause, got %+v", tracker.Name(), pauses)
+		}
+	}
+
+	// The status counts every tracker's sensors and lists each pause once.
+	mockSession = &MockSession{}
+	pauseCmd.Execute(mockSession, m, nil)
+	messages := mockSession.Messages()
+	if len(messages) != 2 || !strings.Contains(messages[0], "1 door(s)") || strings.Count(messages[1], "okno_kuchyn") != 1 {
+		t.Errorf("Unexpected status %q", messages)
+	}
+
+	mockSession = &MockSession{}
+	pauseCmd.Execute(mockSession, m, []string{"off"})
+	if messages := mockSession.Messages(); len(messages) == 0 || messages[0] != "▶️ **Removed 1 pause(s).**" {
+		t.Errorf("Expected the pause to be removed once, got %q", messages)
+	}
+	if len(doors.Pauses()) != 0 || len(windowTracker.Pauses()) != 0 {
+		t.Errorf("Expected no pauses left, got %+v and %+v", doors.Pauses(), windowTracker.Pauses())
+	}
+}
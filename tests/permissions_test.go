@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/bot"
+	"hasscord/config"
+)
+
+func TestPermissions(t *testing.T) {
+	cfg := &config.Config{
+		Token:  "test_token",
+		Prefix: "!",
+		Permissions: map[string]config.Grant{
+			"view":  {Everyone: true},
+			"pause": {Roles: []string{"family"}},
+			"admin": {Users: []string{"owner"}},
+		},
+	}
+	b, err := bot.New(cfg)
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+
+	guest := &discordgo.User{ID: "guest"}
+	owner := &discordgo.User{ID: "owner"}
+	family := &discordgo.Member{Roles: []string{"family"}}
+
+	tests := []struct {
+		name       string
+		user       *discordgo.User
+		member     *discordgo.Member
+		capability bot.Capability
+		want       bool
+	}{
+		{"everyone grant", guest, nil, bot.CapabilityView, true},
+		{"role grant", guest, family, bot.CapabilityPause, true},
+		{"missing role", guest, &discordgo.Member{Roles: []string{"other"}}, bot.CapabilityPause, false},
+		{"no member outside guilds", guest, nil, bot.CapabilityPause, false},
+		{"ungranted capability is denied", guest, family, bot.CapabilityControl, false},
+		{"ungranted capability is open to admins", owner, nil, bot.CapabilityControl, true},
+		{"admin implies pause", owner, nil, bot.CapabilityPause, true},
+		{"admin user", owner, nil, bot.CapabilityAdmin, true},
+		{"admin denied", guest, family, bot.CapabilityAdmin, false},
+	}
+	for _, tt := range tests {
+		if got := b.Allowed(tt.user, tt.member, tt.capability); got != tt.want {
+			t.Errorf("%s: Allowed(%s) = %v, want %v", tt.name, tt.capability, got, tt.want)
+		}
+	}
+}
+
+func TestPartialPermissions(t *testing.T) {
+	guest := &discordgo.User{ID: "guest"}
+	family := &discordgo.Member{Roles: []string{"family"}}
+
+	// Without a permissions section everything is open.
+	b, err := bot.New(&config.Config{Token: "test_token", Prefix: "!"})
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+	for _, capability := range []bot.Capability{bot.CapabilityView, bot.CapabilityPause, bot.CapabilityControl, bot.CapabilityAdmin} {
+		if !b.Allowed(guest, nil, capability) {
+			t.Errorf("Expected %s to be open without a permissions section", capability)
+		}
+	}
+
+	// Granting only pause closes every other capability, admin included.
+	b, err = bot.New(&config.Config{
+		Token:       "test_token",
+		Prefix:      "!",
+		Permissions: map[string]config.Grant{"pause": {Roles: []string{"family"}}},
+	})
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+	tests := []struct {
+		capability bot.Capability
+		want       bool
+	}{
+		{bot.CapabilityPause, true},
+		{bot.CapabilityView, false},
+		{bot.CapabilityControl, false},
+		{bot.CapabilityAdmin, false},
+	}
+	for _, tt := range tests {
+		if got := b.Allowed(guest, family, tt.capability); got != tt.want {
+			t.Errorf("Allowed(%s) with only pause granted = %v, want %v", tt.capability, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hasscord/config"
+	"hasscord/hass"
+	"hasscord/sensors"
+)
+
+func TestRegistryLookups(t *testing.T) {
+	server, client := newHassClient(t)
+	server.SetArea(hass.Area{AreaID: "garage", Name: "Garage"})
+	server.SetArea(hass.Area{AreaID: "hallway", Name: "Hallway"})
+	server.SetDevice(hass.Device{ID: "dev1", Name: "Door sensor", NameByUser: "Garage door sensor", AreaID: "garage"})
+	server.SetEntity(hass.EntityEntry{EntityID: "binary_sensor.dvere_garaz", DeviceID: "dev1", OriginalName: "Opening"})
+	server.SetEntity(hass.EntityEntry{EntityID: "binary_sensor.dvere_vchod", AreaID: "hallway"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := client.LoadRegistries(ctx)
+	if err != nil {
+		t.Fatalf("Error loading registries: %v", err)
+	}
+
+	registry := client.Registry
+	if area := registry.AreaName("binary_sensor.dvere_garaz"); area != "Garage" {
+		t.Errorf("Expected the device's area Garage, got %q", area)
+	}
+	if device := registry.DeviceName("binary_sensor.dvere_garaz"); device != "Garage door sensor" {
+		t.Errorf("Expected the user's device name, got %q", device)
+	}
+	if area := registry.AreaName("binary_sensor.dvere_vchod"); area != "Hallway" {
+		t.Errorf("Expected the entity's own area Hallway, got %q", area)
+	}
+	if name := client.FriendlyName("binary_sensor.dvere_garaz"); name != "Opening" {
+		t.Errorf("Expected the registry's original name, got %q", name)
+	}
+
+	// Registry changes are picked up from registry-updated events.
+	server.SetEntity(hass.EntityEntry{EntityID: "binary_sensor.dvere_garaz", DeviceID: "dev1", AreaID: "hallway"})
+	waitFor(t, 5*time.Second, "entity area update", func() bool {
+		return registry.AreaName("binary_sensor.dvere_garaz") == "Hallway"
+	})
+
+	// Rules match areas by ID and alert templates can use the area and device.
+	rule := config.DefaultRule(15, 60)
+	rule.Areas = []string{"hallway"}
+	rule.Messages.Initial = "{{.Entity}} in {{.Area}} ({{.Device}})"
+	rules, err := sensors.CompileRules([]config.Rule{rule}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+	tracker.SetRegistry(registry)
+
+	tracker.HandleStateChange("binary_sensor.dvere_garaz", doorState("binary_sensor.dvere_garaz", "on"))
+	clock.Advance(15 * time.Second)
+
+	messages := mockSession.Messages()
+	if len(messages) != 1 || messages[0] != "dvere_garaz in Hallway (Garage door sensor)" {
+		t.Errorf("Expected an alert with area and device, got %q", messages)
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"hasscord/hass"
+	"hasscord/hass/hasstest"
+)
+
+func TestNewRESTClientDerivesBaseURL(t *testing.T) {
+	tests := map[string]string{
+		"ws://homeassistant.local:8123/api/websocket": "http://homeassistant.local:8123",
+		"wss://ha.example.com/api/websocket":          "https://ha.example.com",
+		"wss://example.com/ha/api/websocket/":         "https://example.com/ha",
+		"http://homeassistant.local:8123":             "http://homeassistant.local:8123",
+	}
+	for url, want := range tests {
+		client, err := hass.NewRESTClient(url, "token")
+		if err != nil {
+			t.Errorf("NewRESTClient(%q): %v", url, err)
+			continue
+		}
+		if client.BaseURL != want {
+			t.Errorf("NewRESTClient(%q).BaseURL = %q, want %q", url, client.BaseURL, want)
+		}
+	}
+
+	_, err := hass.NewRESTClient("ftp://homeassistant.local", "token")
+	if err == nil {
+		t.Error("Expected an error for an unsupported scheme")
+	}
+}
+
+func TestRESTClient(t *testing.T) {
+	server := hasstest.NewServer()
+	defer server.Close()
+	client, err := hass.NewRESTClient(server.URL(), hasstest.Token)
+	if err != nil {
+		t.Fatalf("Error creating REST client: %v", err)
+	}
+	ctx := context.Background()
+
+	server.SetCameraImage("camera.door", "image/jpeg", []byte("jpeg"))
+	image, contentType, err := client.CameraSnapshot(ctx, "camera.door")
+	if err != nil || string(image) != "jpeg" || contentType != "image/jpeg" {
+		t.Errorf("Unexpected snapshot %q (%s), error %v", image, contentType, err)
+	}
+	_, _, err = client.CameraSnapshot(ctx, "camera.missing")
+	if !errors.Is(err, hass.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing camera, got %v", err)
+	}
+
+	server.ErrorLog = "ERROR (MainThread) [homeassistant] Something broke"
+	text, err := client.ErrorLog(ctx)
+	if err != nil || text != server.ErrorLog {
+		t.Errorf("Unexpected error log %q, error %v", text, err)
+	}
+
+	check, err := client.CheckConfig(ctx)
+	if err != nil || !check.Valid() {
+		t.Errorf("Expected a valid configuration, got %+v, error %v", check, err)
+	}
+	server.ConfigErrors = "Integration error: foo"
+	check, err = client.CheckConfig(ctx)
+	if err != nil || check.Valid() || check.Errors != server.ConfigErrors {
+		t.Errorf("Expected an invalid configuration, got %+v, error %v", check, err)
+	}
+
+	client.Token = "wrong"
+	_, err = client.ErrorLog(ctx)
+	if !errors.Is(err, hass.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for a wrong token, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"testing"
+
+	"hasscord/config"
+	"hasscord/hass"
+	"hasscord/sensors"
+)
+
+func TestRuleMatching(t *testing.T) {
+	rules, err := sensors.CompileRules([]config.Rule{
+		config.DefaultRule(15, 60),
+		{
+			Name:          "windows",
+			Domains:       []string{"binary_sensor"},
+			DeviceClasses: []string{"window"},
+		},
+		{
+			Name:     "obyvak",
+			Entities: []string{"light.*"},
+			Areas:    []string{"obyvak", "Living Room"},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	tests := []struct {
+		state hass.State
+		area  hass.Area
+		want  string
+	}{
+		{hass.State{EntityID: "binary_sensor.dvere_garaz"}, hass.Area{}, "doors"},
+		{hass.State{EntityID: "binary_sensor.dvere_garaz_opening"}, hass.Area{}, ""},
+		{hass.State{EntityID: "binary_sensor.okno", Attributes: map[string]interface{}{"device_class": "window"}}, hass.Area{}, "windows"},
+		{hass.State{EntityID: "sensor.okno", Attributes: map[string]interface{}{"device_class": "window"}}, hass.Area{}, ""},
+		{hass.State{EntityID: "light.kitchen"}, hass.Area{}, ""},
+		// Rule areas match the area ID even when the name differs, or the name.
+		{hass.State{EntityID: "light.stropni"}, hass.Area{AreaID: "obyvak", Name: "Obývák"}, "obyvak"},
+		{hass.State{EntityID: "light.stropni"}, hass.Area{AreaID: "area_2", Name: "Living room"}, "obyvak"},
+		{hass.State{EntityID: "light.stropni"}, hass.Area{AreaID: "kuchyne", Name: "Kuchyně"}, ""},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if rule := sensors.MatchRule(rules, tt.state, tt.area); rule != nil {
+			got = rule.Name
+		}
+		if got != tt.want {
+			t.Errorf("MatchRule(%s) = '%s', want '%s'", tt.state.EntityID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/bot"
+	"hasscord/commands"
+	"hasscord/config"
+	"hasscord/hass"
+)
+
+// DiscordRequest is a REST request the bot sent to Discord.
+type DiscordRequest struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// FakeDiscord answers the bot's Discord REST requests and records them.
+type FakeDiscord struct {
+	mutex    sync.Mutex
+	requests []DiscordRequest
+}
+
+// newFakeDiscord routes the bot session's REST requests to a FakeDiscord.
+func newFakeDiscord(b *bot.Bot) *FakeDiscord {
+	fake := &FakeDiscord{}
+	b.Session.Client = &http.Client{Transport: fake}
+	return fake
+}
+
+// RoundTrip records a request and answers it with an empty message.
+func (d *FakeDiscord) RoundTrip(req *http.Request) (*http.Response, error) {
+	request := DiscordRequest{Method: req.Method, Path: req.URL.Path}
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		json.Unmarshal(body, &request.Body)
+	}
+
+	d.mutex.Lock()
+	d.requests = append(d.requests, request)
+	d.mutex.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"id": "1"}`)),
+		Request:    req,
+	}, nil
+}
+
+// Requests returns the requests received so far.
+func (d *FakeDiscord) Requests() []DiscordRequest {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]DiscordRequest(nil), d.requests...)
+}
+
+// responseType returns the type of an interaction callback request, or -1.
+func responseType(request DiscordRequest) int {
+	if !strings.HasSuffix(request.Path, "/callback") {
+		return -1
+	}
+	t, _ := request.Body["type"].(float64)
+	return int(t)
+}
+
+// responseData returns the data of an interaction callback request.
+func responseData(request DiscordRequest) map[string]interface{} {
+	data, _ := request.Body["data"].(map[string]interface{})
+	return data
+}
+
+// slashInteraction builds a slash command interaction from a user.
+func slashInteraction(itype discordgo.InteractionType, name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        "interaction",
+		AppID:     "app",
+		Token:     "token",
+		Type:      itype,
+		ChannelID: "test_channel",
+		User:      &discordgo.User{ID: "guest", Username: "guest"},
+		Data:      discordgo.ApplicationCommandInteractionData{Name: name, Options: options},
+	}}
+}
+
+func stringOption(name, value string, focused bool) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:    name,
+		Type:    discordgo.ApplicationCommandOptionString,
+		Value:   value,
+		Focused: focused,
+	}
+}
+
+// EchoCommand records the arguments it was run with and suggests many choices.
+type EchoCommand struct {
+	capability bot.Capability
+	args       [][]string
+}
+
+func (e *EchoCommand) Name() string               { return "echo" }
+func (e *EchoCommand) Description() string        { return "Echo the arguments" }
+func (e *EchoCommand) Usage() string              { return "<entity> [since]" }
+func (e *EchoCommand) Examples() []string         { return nil }
+func (e *EchoCommand) Capability() bot.Capability { return e.capability }
+
+func (e *EchoCommand) Options() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{Type: discordgo.ApplicationCommandOptionString, Name: "entity", Required: true, Autocomplete: true},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "since"},
+	}
+}
+
+func (e *EchoCommand) Autocomplete(option, value string) []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for i := 0; i < 30; i++ {
+		entityID := fmt.Sprintf("%s.%s_%d", option, value, i)
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: entityID, Value: entityID})
+	}
+	return choices
+}
+
+func (e *EchoCommand) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
+	e.args = append(e.args, args)
+	if len(args) > 0 {
+		s.ChannelMessageSend(m.ChannelID, strings.Join(args, " "))
+	}
+}
+
+// WordsCommand records its arguments and declares no slash command options.
+type WordsCommand struct {
+	args [][]string
+}
+
+func (w *WordsCommand) Name() string               { return "words" }
+func (w *WordsCommand) Description() string        { return "Record the arguments" }
+func (w *WordsCommand) Usage() string              { return "[word...]" }
+func (w *WordsCommand) Examples() []string         { return nil }
+func (w *WordsCommand) Capability() bot.Capability { return bot.CapabilityView }
+
+func (w *WordsCommand) Execute(s bot.Messager, m *discordgo.MessageCreate, args []string) {
+	w.args = append(w.args, args)
+}
+
+func TestSlashCommandDispatch(t *testing.T) {
+	cfg := &config.Config{
+		Token:  "test_token",
+		Prefix: "!",
+		Permissions: map[string]config.Grant{
+			"view":  {Everyone: true},
+			"admin": {Users: []string{"owner"}},
+		},
+	}
+	b, err := bot.New(cfg)
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+	echo := &EchoCommand{capability: bot.CapabilityView}
+	b.RegisterCommand(echo)
+	words := &WordsCommand{}
+	b.RegisterCommand(words)
+
+	// Options are flattened in the order the command declares them.
+	discord := newFakeDiscord(b)
+	b.HandleInteraction(b.Session, slashInteraction(discordgo.InteractionApplicationCommand, "echo",
+		stringOption("since", "2h", false),
+		stringOption("entity", "lock.front_door", false),
+	))
+	if want := [][]string{{"lock.front_door", "2h"}}; !reflect.DeepEqual(echo.args, want) {
+		t.Errorf("Expected args %q, got %q", want, echo.args)
+	}
+	requests := discord.Requests()
+	if len(requests) != 2 || responseType(requests[0]) != int(discordgo.InteractionResponseDeferredChannelMessageWithSource) {
+		t.Fatalf("Expected a deferred response and an edit, got %+v", requests)
+	}
+	if requests[1].Method != http.MethodPatch || !strings.HasSuffix(requests[1].Path, "/webhooks/app/token/messages/@original") || requests[1].Body["content"] != "lock.front_door 2h" {
+		t.Errorf("Expected the deferred response to be edited with the output, got %+v", requests[1])
+	}
+
+	// A command that sends nothing still completes the deferred response.
+	echo.args = nil
+	discord = newFakeDiscord(b)
+	b.HandleInteraction(b.Session, slashInteraction(discordgo.InteractionApplicationCommand, "echo"))
+	if want := [][]string{nil}; !reflect.DeepEqual(echo.args, want) {
+		t.Errorf("Expected no args, got %q", echo.args)
+	}
+	requests = discord.Requests()
+	if len(requests) != 2 || requests[1].Body["content"] != "✅ Done." {
+		t.Errorf("Expected the deferred response to be completed, got %+v", requests)
+	}
+
+	// Commands without options get their free-form args split into words.
+	b.HandleInteraction(b.Session, slashInteraction(discordgo.InteractionApplicationCommand, "words",
+		stringOption("args", "  a b\tc ", false),
+	))
+	if want := [][]string{{"a", "b", "c"}}; !reflect.DeepEqual(words.args, want) {
+		t.Errorf("Expected args %q, got %q", want, words.args)
+	}
+
+	// Denied commands are answered ephemerally without running.
+	echo.args = nil
+	echo.capability = bot.CapabilityAdmin
+	discord = newFakeDiscord(b)
+	b.HandleInteraction(b.Session, slashInteraction(discordgo.InteractionApplicationCommand, "echo",
+		stringOption("entity", "lock.front_door", false),
+	))
+	if echo.args != nil {
+		t.Errorf("Expected a denied command not to run, got %q", echo.args)
+	}
+	requests = discord.Requests()
+	if len(requests) != 1 || responseType(requests[0]) != int(discordgo.InteractionResponseChannelMessageWithSource) {
+		t.Fatalf("Expected a single response, got %+v", requests)
+	}
+	if data := responseData(requests[0]); data["flags"] != float64(discordgo.MessageFlagsEphemeral) || !strings.Contains(fmt.Sprint(data["content"]), "admin") {
+		t.Errorf("Expected an ephemeral denial, got %+v", data)
+	}
+
+	// Autocomplete answers for the focused option, with at most 25 choices.
+	discord = newFakeDiscord(b)
+	b.HandleInteraction(b.Session, slashInteraction(discordgo.InteractionApplicationCommandAutocomplete, "echo",
+		stringOption("entity", "door", true),
+		stringOption("since", "2h", false),
+	))
+	requests = discord.Requests()
+	if len(requests) != 1 || responseType(requests[0]) != int(discordgo.InteractionApplicationCommandAutocompleteResult) {
+		t.Fatalf("Expected an autocomplete result, got %+v", requests)
+	}
+	choices, _ := responseData(requests[0])["choices"].([]interface{})
+	if len(choices) != 25 {
+		t.Fatalf("Expected 25 choices, got %d", len(choices))
+	}
+	if first := choices[0].(map[string]interface{}); first["value"] != "entity.door_0" {
+		t.Errorf("Expected choices for the focused option, got %v", first)
+	}
+}
+
+func TestEntityChoicesTruncateNames(t *testing.T) {
+	server, client := newHassClient(t)
+	name := strings.Repeat("Čidlo teploty v ložnici ", 5)
+	server.AddState(hass.State{EntityID: "sensor.teplota_loznice", State: "21.5", Attributes: map[string]interface{}{"friendly_name": name}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.SubscribeEntities(ctx); err != nil {
+		t.Fatalf("Error subscribing to entities: %v", err)
+	}
+
+	historyCmd := &commands.History{HassClient: client}
+	choices := historyCmd.Autocomplete("entity", "loznice")
+	if len(choices) != 1 {
+		t.Fatalf("Expected 1 choice, got %d", len(choices))
+	}
+	if label := choices[0].Name; len(label) > 100 || !utf8.ValidString(label) || !strings.HasPrefix(label, "Čidlo") {
+		t.Errorf("Expected a valid label of at most 100 bytes, got %q (%d bytes)", label, len(label))
+	}
+	if choices[0].Value != "sensor.teplota_loznice" {
+		t.Errorf("Expected the entity ID as the value, got %v", choices[0].Value)
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/commands"
+	"hasscord/hass"
+	"hasscord/hass/hasstest"
+)
+
+func TestSnapshotCommand(t *testing.T) {
+	server, client := newHassClient(t)
+	restClient, err := hass.NewRESTClient(server.URL(), hasstest.Token)
+	if err != nil {
+		t.Fatalf("Error creating REST client: %v", err)
+	}
+	server.SetCameraImage("camera.garaz", "image/jpeg", []byte("jpeg"))
+
+	snapshotCmd := &commands.Snapshot{HassClient: client, RESTClient: restClient}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel"},
+	}
+
+	mockSession := &MockSession{}
+	snapshotCmd.Execute(mockSession, m, []string{"camera.GARAZ"})
+	if len(mockSession.Sent) != 1 || len(mockSession.Sent[0].Files) != 1 {
+		t.Fatalf("Expected a message with the snapshot, got %+v", mockSession.Sent)
+	}
+	file := mockSession.Sent[0].Files[0]
+	image, _ := io.ReadAll(file.Reader)
+	if file.Name != "snapshot.jpg" || file.ContentType != "image/jpeg" || string(image) != "jpeg" {
+		t.Errorf("Unexpected snapshot %s (%s) %q", file.Name, file.ContentType, image)
+	}
+	if !strings.Contains(mockSession.Sent[0].Content, "`camera.garaz`") {
+		t.Errorf("Expected the camera to be named, got %q", mockSession.Sent[0].Content)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"missing camera", nil, "**Usage:**"},
+		{"not a camera", []string{"light.kitchen"}, "is not a camera"},
+		{"unknown camera", []string{"camera.missing"}, "**Unknown camera** `camera.missing`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSession := &MockSession{}
+			snapshotCmd.Execute(mockSession, m, tt.args)
+			messages := mockSession.Messages()
+			if len(messages) != 1 || !strings.HasPrefix(messages[0], "❌") || !strings.Contains(messages[0], tt.expected) {
+				t.Errorf("Expected an error containing %q, got %q", tt.expected, messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/commands"
+	"hasscord/config"
+	"hasscord/hass"
+	"hasscord/sensors"
+)
+
+func TestStateCommand(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(doorState("binary_sensor.dvere_garaz", "on"))
+	server.AddState(doorState("binary_sensor.dvere_vchod", "off"))
+	server.AddState(doorState("binary_sensor.dvere_vchod_opening", "off"))
+
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", sensors.RealClock{})
+	tracker.SetRules(rules)
+
+	stateCmd := &commands.State{HassClient: client, Trackers: []*sensors.Tracker{tracker}}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel"},
+	}
+	stateCmd.Execute(mockSession, m, []string{})
+
+	embed := mockSession.Sent[0].Embeds[0]
+	var sb strings.Builder
+	for _, field := range embed.Fields {
+		sb.WriteString(field.Name + "\n" + field.Value + "\n")
+	}
+	listed := sb.String()
+	for _, want := range []string{"No area", "🔴 **dvere_garaz** `binary_sensor.dvere_garaz` · on · <t:", "🟢 **dvere_vchod**"} {
+		if !strings.Contains(listed, want) {
+			t.Errorf("Expected state embed to contain '%s', got:\n%s", want, listed)
+		}
+	}
+	if strings.Contains(listed, "_opening") {
+		t.Errorf("Expected excluded entities to be hidden, got:\n%s", listed)
+	}
+	if embed.Footer.Text != "2 entities · page 1/1" {
+		t.Errorf("Unexpected footer %q", embed.Footer.Text)
+	}
+}
+
+func TestStateCommandFilterPagination(t *testing.T) {
+	server, client := newHassClient(t)
+	for i := 0; i < 60; i++ {
+		server.AddState(hass.State{
+			EntityID:   fmt.Sprintf("light.light_%02d", i),
+			State:      "on",
+			Attributes: map[string]interface{}{"friendly_name": fmt.Sprintf("Light number %02d with a long name", i), "brightness": 255.0},
+		})
+	}
+	server.AddState(doorState("binary_sensor.dvere_garaz", "on"))
+
+	stateCmd := &commands.State{HassClient: client}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel"},
+	}
+	mockSession := &MockSession{}
+	stateCmd.Execute(mockSession, m, []string{"light"})
+
+	sent := mockSession.Sent[0]
+	embed := sent.Embeds[0]
+	if !strings.HasPrefix(embed.Footer.Text, "60 entities · page 1/") || strings.HasSuffix(embed.Footer.Text, "/1") {
+		t.Errorf("Expected 60 lights over several pages, got footer %q", embed.Footer.Text)
+	}
+	for _, field := range embed.Fields {
+		if len(field.Value) > 1024 {
+			t.Errorf("Field %q exceeds Discord's limit with %d characters", field.Name, len(field.Value))
+		}
+		if strings.Contains(field.Value, "dvere") {
+			t.Errorf("Expected only lights, got %s", field.Value)
+		}
+	}
+	if !strings.Contains(embed.Fields[0].Value, "💡 100%") {
+		t.Errorf("Expected brightness to be shown, got %s", embed.Fields[0].Value)
+	}
+	if len(sent.Components) != 1 {
+		t.Fatalf("Expected Previous/Next buttons, got %+v", sent.Components)
+	}
+	buttons := sent.Components[0].(discordgo.ActionsRow).Components
+	if prev := buttons[0].(discordgo.Button); !prev.Disabled || prev.Label != "Previous" {
+		t.Errorf("Expected a disabled Previous button on the first page, got %+v", prev)
+	}
+	if next := buttons[1].(discordgo.Button); next.Disabled || next.CustomID != "state:1:light" {
+		t.Errorf("Expected an enabled Next button to page 2, got %+v", next)
+	}
+}
+
+func TestStateCommandTruncatesLongLines(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(hass.State{
+		EntityID:   "sensor.popis",
+		State:      "ok",
+		Attributes: map[string]interface{}{"friendly_name": strings.Repeat("Žluťoučký kůň ", 80)},
+	})
+
+	stateCmd := &commands.State{HassClient: client}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel"},
+	}
+	mockSession := &MockSession{}
+	stateCmd.Execute(mockSession, m, []string{"sensor"})
+
+	fields := mockSession.Sent[0].Embeds[0].Fields
+	if len(fields) != 1 {
+		t.Fatalf("Expected 1 field, got %d", len(fields))
+	}
+	if value := fields[0].Value; len(value) > 1024 || !utf8.ValidString(value) || !strings.Contains(value, "Žluťoučký kůň") {
+		t.Errorf("Expected a valid line of at most 1024 bytes, got %d bytes: %q", len(value), value)
+	}
+}
+
+func TestStateCommandFilterByArea(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(hass.State{EntityID: "light.stropni", State: "on"})
+	server.AddState(hass.State{EntityID: "light.lampa", State: "off"})
+
+	livingRoom := hass.Area{AreaID: "obyvak", Name: "Living Room"}
+	stateCmd := &commands.State{HassClient: client, AreaOf: func(entityID string) (hass.Area, bool) {
+		if entityID != "light.stropni" {
+			return hass.Area{}, false
+		}
+		return livingRoom, true
+	}}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel"},
+	}
+
+	// Areas are filtered by ID or name, as rules match them.
+	for _, filter := range []string{"obyvak", "living_room", "Living_Room"} {
+		mockSession := &MockSession{}
+		stateCmd.Execute(mockSession, m, []string{filter})
+		if len(mockSession.Sent) != 1 || len(mockSession.Sent[0].Embeds) != 1 {
+			t.Fatalf("Filter %q: expected an embed, got %q", filter, mockSession.Messages())
+		}
+		fields := mockSession.Sent[0].Embeds[0].Fields
+		if len(fields) != 1 || fields[0].Name != "Living Room" || !strings.Contains(fields[0].Value, "stropni") || strings.Contains(fields[0].Value, "lampa") {
+			t.Errorf("Filter %q: expected only the living room light, got %+v", filter, fields)
+		}
+	}
+}
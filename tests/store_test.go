@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hasscord/config"
+	"hasscord/hass"
+	"hasscord/sensors"
+)
+
+// MemoryStore keeps the tracker's snapshot in memory.
+type MemoryStore struct {
+	mutex    sync.Mutex
+	snapshot sensors.Snapshot
+}
+
+// Load returns the last saved snapshot.
+func (m *MemoryStore) Load() (sensors.Snapshot, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.snapshot, nil
+}
+
+// Save replaces the snapshot.
+func (m *MemoryStore) Save(snapshot sensors.Snapshot) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.snapshot = snapshot
+	return nil
+}
+
+// Saved returns the entity IDs of the saved sensors.
+func (m *MemoryStore) Saved() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var entityIDs []string
+	for _, sensor := range m.snapshot.Sensors {
+		entityIDs = append(entityIDs, sensor.EntityID)
+	}
+	return entityIDs
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	store := sensors.NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Error loading missing state file: %v", err)
+	}
+	if len(loaded.Sensors) != 0 || len(loaded.Pauses) != 0 {
+		t.Fatalf("Expected an empty snapshot from a missing file, got %+v", loaded)
+	}
+
+	onTime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	saved := sensors.Snapshot{
+		Sensors: []sensors.SavedSensor{{
+			EntityID: "binary_sensor.dvere_garaz",
+			Rule:     "doors",
+			State:    "on",
+			OnTime:   onTime,
+			Paused:   true,
+			AckedBy:  "alice",
+		}},
+		Pauses: []sensors.Pause{{Pattern: "*garaz*", Until: onTime.Add(time.Hour)}},
+	}
+
+	err = store.Save(saved)
+	if err != nil {
+		t.Fatalf("Error saving state: %v", err)
+	}
+
+	loaded, err = sensors.NewFileStore(store.Path).Load()
+	if err != nil {
+		t.Fatalf("Error loading state: %v", err)
+	}
+	if len(loaded.Sensors) != 1 || len(loaded.Pauses) != 1 {
+		t.Fatalf("Expected 1 sensor and 1 pause, got %+v", loaded)
+	}
+	sensor := loaded.Sensors[0]
+	if sensor.EntityID != "binary_sensor.dvere_garaz" || !sensor.OnTime.Equal(onTime) || !sensor.Paused || sensor.AckedBy != "alice" {
+		t.Errorf("Loaded sensor does not match saved one: %+v", sensor)
+	}
+	if loaded.Pauses[0].Pattern != "*garaz*" || !loaded.Pauses[0].Until.Equal(onTime.Add(time.Hour)) {
+		t.Errorf("Loaded pause does not match saved one: %+v", loaded.Pauses[0])
+	}
+}
+
+func TestTrackerRestoreState(t *testing.T) {
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	store := &MemoryStore{snapshot: sensors.Snapshot{Sensors: []sensors.SavedSensor{
+		// Still open, not yet alerted: the initial alert is due 5s after the restart.
+		{EntityID: "binary_sensor.dvere_garaz", Rule: "doors", State: "on", OnTime: now.Add(-10 * time.Second)},
+		// Still open and alerted: the next reminder is due 30s after the restart.
+		{EntityID: "binary_sensor.dvere_sklep", Rule: "doors", State: "on", OnTime: now.Add(-2 * time.Minute), LastSent: now.Add(-30 * time.Second)},
+		// Closed while the bot was down after an alert.
+		{EntityID: "binary_sensor.dvere_vchod", Rule: "doors", State: "on", OnTime: now.Add(-5 * time.Minute), LastSent: now.Add(-4 * time.Minute)},
+		// Closed while the bot was down before an alert.
+		{EntityID: "binary_sensor.dvere_kuchyn", Rule: "doors", State: "on", OnTime: now.Add(-10 * time.Second)},
+		// Watched by a rule that was removed from the configuration.
+		{EntityID: "binary_sensor.okno", Rule: "windows", State: "on", OnTime: now.Add(-time.Hour), LastSent: now.Add(-time.Minute)},
+	}}}
+
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+	tracker.SetStore(store)
+	tracker.RestoreState([]hass.State{
+		doorState("binary_sensor.dvere_garaz", "on"),
+		doorState("binary_sensor.dvere_sklep", "on"),
+		doorState("binary_sensor.dvere_vchod", "off"),
+		doorState("binary_sensor.dvere_kuchyn", "off"),
+		doorState("binary_sensor.okno", "on"),
+	})
+
+	// Only the alerted door that closed is announced.
+	messages := mockSession.Messages()
+	if len(messages) != 1 || messages[0] != "Door `dvere_vchod` is now closed." {
+		t.Fatalf("Expected a resolved message for dvere_vchod only, got %q", messages)
+	}
+	tracked := tracker.Sensors()
+	if len(tracked) != 2 {
+		t.Errorf("Expected 2 restored sensors, got %v", tracked)
+	}
+	for _, entityID := range []string{"binary_sensor.dvere_garaz", "binary_sensor.dvere_sklep"} {
+		if _, ok := tracked[entityID]; !ok {
+			t.Errorf("Expected %s to be restored", entityID)
+		}
+	}
+	if saved := store.Saved(); strings.Join(saved, ",") != "binary_sensor.dvere_garaz,binary_sensor.dvere_sklep" {
+		t.Errorf("Expected the dropped sensors to be removed from the store, got %v", saved)
+	}
+
+	// Timers continue from the saved times rather than starting over.
+	clock.Advance(4 * time.Second)
+	if got := len(mockSession.Messages()); got != 1 {
+		t.Fatalf("Expected no alert before the restored timeout, got %d message(s)", got)
+	}
+	clock.Advance(time.Second)
+	messages = mockSession.Messages()
+	if len(messages) != 2 || !strings.Contains(messages[1], "dvere_garaz") || strings.HasPrefix(messages[1], "Reminder:") {
+		t.Fatalf("Expected the initial alert for dvere_garaz 5s after the restore, got %q", messages)
+	}
+	clock.Advance(25 * time.Second)
+	messages = mockSession.Messages()
+	if len(messages) != 3 || !strings.HasPrefix(messages[2], "Reminder:") || !strings.Contains(messages[2], "dvere_sklep") {
+		t.Fatalf("Expected a reminder for dvere_sklep 30s after the restore, got %q", messages)
+	}
+}
+
+func TestFileStoreReadsLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	legacy := `[
+  {
+    "entity_id": "binary_sensor.dvere_garaz",
+    "rule": "doors",
+    "state": "on",
+    "on_time": "2025-01-02T03:04:05Z",
+    "last_sent": "2025-01-02T03:04:20Z",
+    "snoozed_until": "0001-01-01T00:00:00Z"
+  }
+]`
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatalf("Error writing state file: %v", err)
+	}
+
+	store := sensors.NewFileStore(path)
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Error loading legacy state file: %v", err)
+	}
+	if len(loaded.Sensors) != 1 || len(loaded.Pauses) != 0 {
+		t.Fatalf("Expected 1 sensor and no pauses, got %+v", loaded)
+	}
+	if sensor := loaded.Sensors[0]; sensor.EntityID != "binary_sensor.dvere_garaz" || !sensor.LastSent.Equal(time.Date(2025, 1, 2, 3, 4, 20, 0, time.UTC)) {
+		t.Errorf("Loaded sensor does not match the legacy one: %+v", sensor)
+	}
+
+	// Saving the same sensors writes the current format.
+	if err := store.Save(loaded); err != nil {
+		t.Fatalf("Error saving state: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading state file: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "{") {
+		t.Errorf("Expected the state file to be rewritten as a snapshot, got:\n%s", data)
+	}
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"hasscord/bot"
+	"hasscord/commands"
+	"hasscord/config"
+	"hasscord/hass"
+)
+
+func TestTemplateCommand(t *testing.T) {
+	server, client := newHassClient(t)
+	lights := 2
+	server.TemplateHandler = func(template string) (interface{}, error) {
+		if strings.Contains(template, "{% if") {
+			return nil, errors.New("TemplateSyntaxError: unexpected end of template")
+		}
+		return lights, nil
+	}
+
+	templateCmd := &commands.Template{HassClient: client}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel", Author: &discordgo.User{Username: "alice"}},
+	}
+
+	mockSession := &MockSession{}
+	templateCmd.Execute(mockSession, m, strings.Fields("`{{ states.light | count }}`"))
+	if messages := mockSession.Messages(); len(messages) != 1 || messages[0] != "```\n2\n```" {
+		t.Errorf("Expected the rendered result, got %q", messages)
+	}
+
+	mockSession = &MockSession{}
+	templateCmd.Execute(mockSession, m, strings.Fields("{% if true %}"))
+	if messages := mockSession.Messages(); len(messages) != 1 || !strings.Contains(messages[0], "TemplateSyntaxError") {
+		t.Errorf("Expected the template error, got %q", messages)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.RenderTemplate(ctx, "{% if true %}"); !errors.Is(err, hass.ErrTemplateError) {
+		t.Errorf("Expected ErrTemplateError, got %v", err)
+	}
+
+	// Watched templates are edited as the result changes.
+	mockSession = &MockSession{}
+	templateCmd.Execute(mockSession, m, strings.Fields("--watch {{ states.light | count }}"))
+	sent := mockSession.Sent
+	if len(sent) != 1 || len(sent[0].Components) != 1 {
+		t.Fatalf("Expected a message with a Stop button, got %+v", sent)
+	}
+	waitFor(t, time.Second, "first result", func() bool {
+		edit := mockSession.LastEdit()
+		return edit != nil && strings.HasPrefix(*edit.Content, "```\n2\n```")
+	})
+
+	lights = 3
+	server.RenderTemplates()
+	waitFor(t, 5*time.Second, "updated result", func() bool {
+		return strings.HasPrefix(*mockSession.LastEdit().Content, "```\n3\n```")
+	})
+
+}
+
+func TestTemplateCommandTruncatesLongResults(t *testing.T) {
+	server, client := newHassClient(t)
+	server.TemplateHandler = func(template string) (interface{}, error) {
+		return strings.Repeat("žába ", 500), nil
+	}
+
+	templateCmd := &commands.Template{HassClient: client}
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel", Author: &discordgo.User{Username: "alice"}},
+	}
+
+	mockSession := &MockSession{}
+	templateCmd.Execute(mockSession, m, strings.Fields("{{ long }}"))
+	messages := mockSession.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+	if message := messages[0]; len(message) > 2000 || !utf8.ValidString(message) || !strings.HasSuffix(message, "…\n```") {
+		t.Errorf("Expected a valid truncated result of at most 2000 bytes, got %d bytes: %q", len(message), message)
+	}
+}
+
+func TestTemplateCommandKeepsRawText(t *testing.T) {
+	server, client := newHassClient(t)
+	var mutex sync.Mutex
+	var rendered []string
+	server.TemplateHandler = func(template string) (interface{}, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		rendered = append(rendered, template)
+		return "ok", nil
+	}
+	renderedTemplates := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), rendered...)
+	}
+
+	b, err := bot.New(&config.Config{Token: "test_token", Prefix: "!"})
+	if err != nil {
+		t.Fatalf("Error creating bot: %v", err)
+	}
+	templateCmd := &commands.Template{HassClient: client}
+	templateCmd.RegisterButtons(b)
+
+	// Newlines and repeated spaces reach Home Assistant unchanged.
+	template := "{% raw %}a  b{% endraw %}\n{% for i in range(2) %}\n  {{ i }}\n{% endfor %}"
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{ChannelID: "test_channel", Content: "!template " + template, Author: &discordgo.User{Username: "alice"}},
+	}
+	mockSession := &MockSession{}
+	templateCmd.Execute(mockSession, m, strings.Fields(template))
+	if rendered := renderedTemplates(); len(rendered) != 1 || rendered[0] != template {
+		t.Errorf("Expected the template %q, got %q", template, rendered)
+	}
+
+	m.Content = "!template --watch " + template
+	mockSession = &MockSession{}
+	templateCmd.Execute(mockSession, m, strings.Fields("--watch "+template))
+	if len(mockSession.Sent) != 1 || len(mockSession.Sent[0].Components) != 1 {
+		t.Fatalf("Expected a message with a Stop button, got %+v", mockSession.Sent)
+	}
+	waitFor(t, time.Second, "watched template", func() bool {
+		return len(renderedTemplates()) > 1
+	})
+	if rendered := renderedTemplates(); rendered[1] != template {
+		t.Errorf("Expected the watched template %q, got %q", template, rendered[1])
+	}
+
+	// Stop works for interactions without a user.
+	stop := mockSession.Sent[0].Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button).CustomID
+	discord := newFakeDiscord(b)
+	press := buttonPress(stop, "ok")
+	press.User = nil
+	b.HandleInteraction(b.Session, press)
+	if content := editedContent(t, discord.Requests()); !strings.HasSuffix(content, "⏹️ Stopped by someone.") {
+		t.Errorf("Unexpected stopped message %q", content)
+	}
+}
@@ -0,0 +1,445 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hasscord/config"
+	"hasscord/hass"
+	"hasscord/sensors"
+)
+
+// FakeClock is a sensors.Clock whose time only moves when Advance is called.
+type FakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *FakeClock
+	when    time.Time
+	f       func()
+	stopped bool
+}
+
+// NewFakeClock creates a clock starting at the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// AfterFunc schedules f to run when the clock is advanced past d.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) sensors.Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	timer := &fakeTimer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Advance moves the clock forward, running due timers in order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	target := c.now.Add(d)
+	c.mutex.Unlock()
+
+	for {
+		c.mutex.Lock()
+		var next *fakeTimer
+		for _, timer := range c.timers {
+			if !timer.stopped && !timer.when.After(target) && (next == nil || timer.when.Before(next.when)) {
+				next = timer
+			}
+		}
+		if next == nil {
+			c.now = target
+			c.mutex.Unlock()
+			return
+		}
+		next.stopped = true
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		c.mutex.Unlock()
+
+		next.f()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	active := !t.stopped
+	t.stopped = true
+	return active
+}
+
+func TestTrackerTiming(t *testing.T) {
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+
+	tracker.HandleStateChange("binary_sensor.dvere_garaz", doorState("binary_sensor.dvere_garaz", "on"))
+
+	clock.Advance(14 * time.Second)
+	if got := len(mockSession.Messages()); got != 0 {
+		t.Fatalf("Expected no alert before the timeout, got %d message(s)", got)
+	}
+
+	clock.Advance(time.Second)
+	messages := mockSession.Messages()
+	if len(messages) != 1 || !strings.Contains(messages[0], "more than 15 seconds") {
+		t.Fatalf("Expected the initial alert at 15s, got %q", messages)
+	}
+
+	clock.Advance(59 * time.Second)
+	if got := len(mockSession.Messages()); got != 1 {
+		t.Fatalf("Expected no reminder before 60s, got %d message(s)", got)
+	}
+
+	clock.Advance(time.Second)
+	messages = mockSession.Messages()
+	if len(messages) != 2 || !strings.HasPrefix(messages[1], "Reminder:") {
+		t.Fatalf("Expected a reminder 60s after the alert, got %q", messages)
+	}
+
+	clock.Advance(time.Hour)
+	messages = mockSession.Messages()
+	if last := messages[len(messages)-1]; !strings.Contains(last, "Stopping reminders") {
+		t.Errorf("Expected the give-up message last, got %q", last)
+	}
+	if _, tracked := tracker.Sensors()["binary_sensor.dvere_garaz"]; tracked {
+		t.Error("Expected the sensor to stop being tracked after the max reminder duration")
+	}
+
+	// A door closed after alerting is announced as resolved.
+	tracker.HandleStateChange("binary_sensor.dvere_kuchyn", doorState("binary_sensor.dvere_kuchyn", "on"))
+	clock.Advance(15 * time.Second)
+	tracker.HandleStateChange("binary_sensor.dvere_kuchyn", doorState("binary_sensor.dvere_kuchyn", "off"))
+
+	messages = mockSession.Messages()
+	if last := messages[len(messages)-1]; last != "Door `dvere_kuchyn` is now closed." {
+		t.Errorf("Expected the resolved message, got %q", last)
+	}
+}
+
+func TestIndependentTrackers(t *testing.T) {
+	windows := config.DefaultRule(15, 60)
+	windows.Name = "windows"
+	windows.Entities = []string{"binary_sensor.okno_*"}
+	windows.Exclude = nil
+
+	doorRules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+	windowRules, err := sensors.CompileRules([]config.Rule{windows}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	doorSession, windowSession := &MockSession{}, &MockSession{}
+	doors := sensors.NewTracker(doorSession, "doors", "doors", clock)
+	doors.SetRules(doorRules)
+	windowTracker := sensors.NewTracker(windowSession, "windows", "windows", clock)
+	windowTracker.SetRules(windowRules)
+
+	windowTracker.AddPause("*", time.Time{}, "alice")
+	for _, tracker := range []*sensors.Tracker{doors, windowTracker} {
+		tracker.HandleStateChange("binary_sensor.dvere_garaz", doorState("binary_sensor.dvere_garaz", "on"))
+		tracker.HandleStateChange("binary_sensor.okno_kuchyn", doorState("binary_sensor.okno_kuchyn", "on"))
+	}
+	clock.Advance(15 * time.Second)
+
+	if got := len(doors.Sensors()); got != 1 {
+		t.Errorf("Expected the door tracker to track 1 sensor, got %d", got)
+	}
+	if messages := doorSession.Messages(); len(messages) != 1 || doorSession.ChannelID != "doors" {
+		t.Errorf("Expected one door alert in the doors channel, got %q in %s", messages, doorSession.ChannelID)
+	}
+	if _, tracked := windowTracker.Sensors()["binary_sensor.okno_kuchyn"]; !tracked {
+		t.Error("Expected the window tracker to track the window")
+	}
+	if messages := windowSession.Messages(); len(messages) != 0 {
+		t.Errorf("Expected the paused window tracker to stay quiet, got %q", messages)
+	}
+}
+
+func TestTriggerRules(t *testing.T) {
+	server, client := newHassClient(t)
+
+	hot := config.Rule{
+		Name: "hot",
+		Trigger: []map[string]interface{}{
+			{"platform": "numeric_state", "entity_id": "sensor.teplota", "above": 30, "for": map[string]interface{}{"minutes": 10}},
+		},
+		ResolveTrigger: []map[string]interface{}{
+			{"platform": "numeric_state", "entity_id": "sensor.teplota", "below": 28},
+		},
+		Messages: config.RuleMessages{Resolved: "`{{.Entity}}` is back to {{.State}}."},
+	}
+	morning := config.Rule{
+		Name:    "morning",
+		Trigger: []map[string]interface{}{{"platform": "time", "at": "07:00:00"}},
+	}
+	rules, err := sensors.CompileRules([]config.Rule{hot, morning}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+	err = tracker.SubscribeTriggers(client)
+	if err != nil {
+		t.Fatalf("Error subscribing to triggers: %v", err)
+	}
+	waitFor(t, time.Second, "trigger subscriptions", func() bool { return server.Subscriptions() == 3 })
+
+	platform := func(name, key string) func(json.RawMessage) bool {
+		return func(trigger json.RawMessage) bool {
+			return strings.Contains(string(trigger), name) && strings.Contains(string(trigger), key)
+		}
+	}
+	hotState := hass.State{EntityID: "sensor.teplota", State: "31.5"}
+	server.FireTrigger(platform("numeric_state", "above"), hass.TriggerData{Platform: "numeric_state", EntityID: "sensor.teplota", ToState: &hotState})
+
+	// Home Assistant already waited, so the alert goes out right away.
+	waitFor(t, time.Second, "trigger alert", func() bool { return len(mockSession.Messages()) == 1 })
+	if messages := mockSession.Messages(); messages[0] != "`teplota` is `31.5`! @everyone" {
+		t.Errorf("Unexpected trigger alert %q", messages[0])
+	}
+
+	// State snapshots don't resolve trigger alerts, reminders keep going.
+	tracker.SyncStates(nil)
+	clock.Advance(60 * time.Second)
+	if messages := mockSession.Messages(); len(messages) != 2 || !strings.HasPrefix(messages[1], "Reminder:") {
+		t.Fatalf("Expected a reminder, got %q", messages)
+	}
+
+	coolState := hass.State{EntityID: "sensor.teplota", State: "27"}
+	server.FireTrigger(platform("numeric_state", "below"), hass.TriggerData{Platform: "numeric_state", EntityID: "sensor.teplota", ToState: &coolState})
+	waitFor(t, time.Second, "resolved message", func() bool { return len(mockSession.Messages()) == 3 })
+	if messages := mockSession.Messages(); messages[2] != "`teplota` is back to 27." {
+		t.Errorf("Unexpected resolved message %q", messages[2])
+	}
+
+	// Without a resolve trigger, only the initial message is sent.
+	server.FireTrigger(platform("time", "07:00"), hass.TriggerData{Platform: "time", Description: "time"})
+	waitFor(t, time.Second, "time trigger alert", func() bool { return len(mockSession.Messages()) == 4 })
+	if messages := mockSession.Messages(); messages[3] != "`morning` is `triggered`! @everyone" {
+		t.Errorf("Unexpected time trigger alert %q", messages[3])
+	}
+	if got := len(tracker.Sensors()); got != 0 {
+		t.Errorf("Expected nothing tracked, got %d sensor(s)", got)
+	}
+}
+
+func TestThresholdRules(t *testing.T) {
+	above, below := -15.0, 30.0
+	freezer := config.Rule{
+		Name:       "freezer",
+		Entities:   []string{"sensor.mrazak_teplota"},
+		Above:      &above,
+		Hysteresis: 2,
+		Timeout:    600,
+		Reminder:   900,
+	}
+	humidity := config.Rule{Name: "humidity", DeviceClasses: []string{"humidity"}, Below: &below}
+	rules, err := sensors.CompileRules([]config.Rule{freezer, humidity}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+
+	temperature := func(value string) {
+		tracker.HandleStateChange("sensor.mrazak_teplota", hass.State{EntityID: "sensor.mrazak_teplota", State: value})
+	}
+	temperature("-18")
+	temperature("-14.5")
+	clock.Advance(5 * time.Minute)
+	temperature("-13")
+	clock.Advance(5 * time.Minute)
+	if messages := mockSession.Messages(); len(messages) != 1 || messages[0] != "`mrazak_teplota` has been above -15 for more than 600 seconds (now `-13`)! @everyone" {
+		t.Fatalf("Expected the threshold alert, got %q", messages)
+	}
+
+	// Within the hysteresis the alert doesn't resolve, and reminders show the latest value.
+	temperature("-16")
+	temperature("unavailable")
+	clock.Advance(15 * time.Minute)
+	if messages := mockSession.Messages(); len(messages) != 2 || !strings.Contains(messages[1], "still `unavailable`") {
+		t.Fatalf("Expected a reminder, got %q", messages)
+	}
+	temperature("-17.5")
+	if messages := mockSession.Messages(); len(messages) != 3 || messages[2] != "`mrazak_teplota` is back to normal (`-17.5`)." {
+		t.Fatalf("Expected the recovery message, got %q", messages)
+	}
+
+	// Before the initial alert, dropping back below the threshold ends it even within the hysteresis.
+	temperature("-14")
+	clock.Advance(5 * time.Minute)
+	temperature("-16")
+	clock.Advance(10 * time.Minute)
+	if messages := mockSession.Messages(); len(messages) != 3 {
+		t.Fatalf("Expected no alert for a value back below the threshold, got %q", messages[3:])
+	}
+	if got := len(tracker.Sensors()); got != 0 {
+		t.Fatalf("Expected nothing tracked, got %d sensor(s)", got)
+	}
+
+	// Below thresholds alert on low values, and values that aren't numbers never start an alert.
+	humid := func(value string) hass.State {
+		return hass.State{EntityID: "sensor.loznice_vlhkost", State: value, Attributes: map[string]interface{}{"device_class": "humidity"}}
+	}
+	tracker.SyncStates([]hass.State{humid("unknown")})
+	if got := len(tracker.Sensors()); got != 0 {
+		t.Fatalf("Expected nothing tracked, got %d sensor(s)", got)
+	}
+	tracker.HandleStateChange("sensor.loznice_vlhkost", humid("28"))
+	clock.Advance(15 * time.Second)
+	if messages := mockSession.Messages(); len(messages) != 4 || !strings.Contains(messages[3], "below 30") {
+		t.Fatalf("Expected the humidity alert, got %q", messages)
+	}
+	tracker.SyncStates([]hass.State{humid("30")})
+	if messages := mockSession.Messages(); len(messages) != 5 || !strings.Contains(messages[4], "back to normal") {
+		t.Errorf("Expected the humidity to recover, got %q", messages)
+	}
+}
+
+func TestSyncStates(t *testing.T) {
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	mockSession := &MockSession{}
+	tracker := sensors.NewTracker(mockSession, "doors", "alerts", clock)
+	tracker.SetRules(rules)
+
+	changedAt := func(state hass.State, at time.Time) hass.State {
+		state.LastChanged = at.Format(time.RFC3339Nano)
+		return state
+	}
+
+	// On startup, open doors are tracked from when they opened.
+	tracker.SyncStates([]hass.State{
+		changedAt(doorState("binary_sensor.dvere_garaz", "on"), now.Add(-10*time.Second)),
+		changedAt(doorState("binary_sensor.dvere_vchod", "on"), now.Add(-time.Minute)),
+		doorState("binary_sensor.dvere_sklep", "on"),
+		doorState("binary_sensor.dvere_kuchyn", "off"),
+		doorState("binary_sensor.dvere_garaz_opening", "on"),
+	})
+	tracked := tracker.Sensors()
+	if len(tracked) != 3 {
+		t.Fatalf("Expected 3 tracked sensors, got %v", tracked)
+	}
+	if onTime := tracked["binary_sensor.dvere_garaz"].OnTime; !onTime.Equal(now.Add(-10 * time.Second)) {
+		t.Errorf("Expected dvere_garaz to be tracked from its last change, got %v", onTime)
+	}
+	if onTime := tracked["binary_sensor.dvere_sklep"].OnTime; !onTime.Equal(now) {
+		t.Errorf("Expected dvere_sklep without last_changed to be tracked from now, got %v", onTime)
+	}
+	// The door open for a minute is already past its timeout.
+	messages := mockSession.Messages()
+	if len(messages) != 1 || !strings.Contains(messages[0], "dvere_vchod") {
+		t.Fatalf("Expected an immediate alert for dvere_vchod, got %q", messages)
+	}
+
+	clock.Advance(5 * time.Second)
+	messages = mockSession.Messages()
+	if len(messages) != 2 || !strings.Contains(messages[1], "dvere_garaz") {
+		t.Fatalf("Expected the alert for dvere_garaz 15s after it opened, got %q", messages)
+	}
+
+	// After a reconnect, doors closed in the meantime are resolved, and doors
+	// still open keep their timers.
+	tracker.SyncStates([]hass.State{
+		changedAt(doorState("binary_sensor.dvere_garaz", "off"), now.Add(2*time.Second)),
+		changedAt(doorState("binary_sensor.dvere_sklep", "on"), now.Add(3*time.Second)),
+	})
+	tracked = tracker.Sensors()
+	if len(tracked) != 1 {
+		t.Fatalf("Expected only dvere_sklep to stay tracked, got %v", tracked)
+	}
+	if onTime := tracked["binary_sensor.dvere_sklep"].OnTime; !onTime.Equal(now) {
+		t.Errorf("Expected dvere_sklep to keep its original on time, got %v", onTime)
+	}
+	// dvere_garaz and dvere_vchod, which vanished from the snapshot, were alerted.
+	messages = mockSession.Messages()
+	if len(messages) != 4 {
+		t.Fatalf("Expected 2 resolved messages, got %q", messages)
+	}
+	resolved := strings.Join(messages[2:], "\n")
+	for _, want := range []string{"Door `dvere_garaz` is now closed.", "dvere_vchod"} {
+		if !strings.Contains(resolved, want) {
+			t.Errorf("Expected resolved messages to contain %q, got %q", want, resolved)
+		}
+	}
+}
+
+func TestTrackerResyncsAfterDroppedEvents(t *testing.T) {
+	server, client := newHassClient(t)
+	server.AddState(doorState("binary_sensor.dvere_garaz", "off"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sub, err := client.SubscribeEntities(ctx)
+	if err != nil {
+		t.Fatalf("Error subscribing to entities: %v", err)
+	}
+
+	// The door opens, then enough other changes arrive before the tracker
+	// reads any that the door's event is dropped.
+	server.SetState(doorState("binary_sensor.dvere_garaz", "on"))
+	const events = 300
+	for i := 0; i < events; i++ {
+		server.SetState(hass.State{EntityID: "sensor.counter", State: fmt.Sprint(i)})
+	}
+	waitFor(t, 5*time.Second, "state cache update", func() bool {
+		state, ok := client.States.Get("sensor.counter")
+		return ok && state.State == fmt.Sprint(events-1)
+	})
+	if sub.Dropped() == 0 {
+		t.Fatal("Expected events to be dropped")
+	}
+
+	rules, err := sensors.CompileRules([]config.Rule{config.DefaultRule(15, 60)}, nil)
+	if err != nil {
+		t.Fatalf("Error compiling rules: %v", err)
+	}
+	tracker := sensors.NewTracker(&MockSession{}, "doors", "alerts", NewFakeClock(time.Now()))
+	tracker.SetRules(rules)
+	go sensors.HandleEntities(sub, client.States, tracker)
+
+	waitFor(t, 5*time.Second, "door to be tracked", func() bool {
+		_, tracked := tracker.Sensors()["binary_sensor.dvere_garaz"]
+		return tracked
+	})
+}